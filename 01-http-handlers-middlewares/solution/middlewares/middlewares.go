@@ -8,7 +8,11 @@ import (
 
 func TrackingID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := tracking.ContextWithID(r.Context())
+		ctx, err := tracking.ContextWithID(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,335 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// AccessLogFormat is the format of the access log lines.
+type AccessLogFormat int
+
+const (
+	// FormatCommon is the Apache Common Log Format.
+	FormatCommon AccessLogFormat = iota
+	// FormatCombined is the Apache Combined Log Format, the Common one plus referer and user agent.
+	FormatCombined
+	// FormatLogfmt writes key=value pairs.
+	FormatLogfmt
+	// FormatJSON writes an AccessLogEntry as a JSON object.
+	FormatJSON
+	// FormatTemplate executes AccessLogConfig.Template with an AccessLogEntry.
+	FormatTemplate
+)
+
+// clfTimeLayout is the Common Log Format time layout.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogEntry is a finished request, as written to the access log.
+type AccessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	User       string        `json:"user,omitempty"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Proto      string        `json:"proto"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+	Duration   time.Duration `json:"-"`
+	TrackingID string        `json:"tracking_id,omitempty"`
+}
+
+// MarshalJSON adds the duration in milliseconds.
+func (e AccessLogEntry) MarshalJSON() ([]byte, error) {
+	type entry AccessLogEntry
+	return json.Marshal(struct {
+		entry
+		DurationMs float64 `json:"duration_ms"`
+	}{entry(e), float64(e.Duration) / float64(time.Millisecond)})
+}
+
+// AccessLogConfig configures an AccessLog.
+type AccessLogConfig struct {
+	Format AccessLogFormat
+	// Template is a text/template executed with an AccessLogEntry, used when Format is
+	// FormatTemplate. A new line is added if the template output does not end with one.
+	Template string
+	// QueueSize is how many lines can wait to be written, lines logged while the queue
+	// is full are dropped. Defaults to 1024.
+	QueueSize int
+}
+
+// ErrAccessLogClosed is returned by AccessLog.Close when it's called more than once.
+var ErrAccessLogClosed = errors.New("access log already closed")
+
+// AccessLog is a middleware writing an access log line for every request. Lines are written
+// asynchronously, so a slow writer never adds latency to the requests. If the writer cannot
+// keep up, lines are dropped, see Dropped.
+type AccessLog struct {
+	format func(*bytes.Buffer, AccessLogEntry) error
+
+	queue   chan []byte
+	dropped uint64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	err    error
+}
+
+// NewAccessLog returns an AccessLog writing to w. Call Close to write the queued lines.
+func NewAccessLog(w io.Writer, cfg AccessLogConfig) (*AccessLog, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+
+	l := &AccessLog{
+		queue: make(chan []byte, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+
+	switch cfg.Format {
+	case FormatCommon:
+		l.format = func(b *bytes.Buffer, e AccessLogEntry) error { writeCommon(b, e); return nil }
+	case FormatCombined:
+		l.format = func(b *bytes.Buffer, e AccessLogEntry) error { writeCombined(b, e); return nil }
+	case FormatLogfmt:
+		l.format = func(b *bytes.Buffer, e AccessLogEntry) error { writeLogfmt(b, e); return nil }
+	case FormatJSON:
+		l.format = func(b *bytes.Buffer, e AccessLogEntry) error { return json.NewEncoder(b).Encode(e) }
+	case FormatTemplate:
+		tmpl, err := template.New("access_log").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log template: %w", err)
+		}
+		l.format = func(b *bytes.Buffer, e AccessLogEntry) error { return tmpl.Execute(b, e) }
+	default:
+		return nil, fmt.Errorf("unknown access log format %d", cfg.Format)
+	}
+
+	go l.run(w)
+
+	return l, nil
+}
+
+// Handler returns next wrapped by the access log.
+func (l *AccessLog) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw, ww := newResponseWriter(w)
+
+		next.ServeHTTP(ww, r)
+
+		l.Log(AccessLogEntry{
+			Time:       start,
+			RemoteAddr: remoteHost(r),
+			User:       requestUser(r),
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     rw.Status(),
+			Bytes:      rw.BytesWritten(),
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			Duration:   time.Since(start),
+			TrackingID: tracking.IdFromContext(r.Context()),
+		})
+	})
+}
+
+// Log formats e and queues it to be written. It never blocks, if the queue is full e is dropped.
+func (l *AccessLog) Log(e AccessLogEntry) {
+	b := &bytes.Buffer{}
+	if err := l.format(b, e); err != nil {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+	// the formats write the line, the new line is added here, unless it's there already,
+	// e.g. written by the JSON encoder or the template
+	if b.Len() == 0 || b.Bytes()[b.Len()-1] != '\n' {
+		b.WriteByte('\n')
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+
+	select {
+	case l.queue <- b.Bytes():
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+}
+
+// Dropped returns how many lines were dropped because the queue was full, the log was
+// closed or the line could not be formatted.
+func (l *AccessLog) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Close writes the queued lines and stops the access log. It returns the first error
+// returned by the writer, if any.
+func (l *AccessLog) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrAccessLogClosed
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.err
+}
+
+func (l *AccessLog) run(w io.Writer) {
+	defer close(l.done)
+
+	bw := bufio.NewWriter(w)
+	for line := range l.queue {
+		if _, err := bw.Write(line); err != nil && l.err == nil {
+			l.err = err
+		}
+
+		// flush once there is nothing else to write
+		if len(l.queue) == 0 {
+			if err := bw.Flush(); err != nil && l.err == nil {
+				l.err = err
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+func writeCommon(b *bytes.Buffer, e AccessLogEntry) {
+	b.WriteString(orDash(e.RemoteAddr))
+	b.WriteString(" - ")
+	b.WriteString(escapeCLF(orDash(e.User)))
+	b.WriteString(" [")
+	b.WriteString(e.Time.Format(clfTimeLayout))
+	b.WriteString(`] "`)
+	b.WriteString(escapeCLF(e.Method + " " + e.URI + " " + e.Proto))
+	b.WriteString(`" `)
+	b.WriteString(strconv.Itoa(e.Status))
+	b.WriteByte(' ')
+	if e.Bytes == 0 {
+		b.WriteByte('-')
+	} else {
+		b.WriteString(strconv.FormatInt(e.Bytes, 10))
+	}
+}
+
+func writeCombined(b *bytes.Buffer, e AccessLogEntry) {
+	writeCommon(b, e)
+	b.WriteString(` "`)
+	b.WriteString(escapeCLF(orDash(e.Referer)))
+	b.WriteString(`" "`)
+	b.WriteString(escapeCLF(orDash(e.UserAgent)))
+	b.WriteByte('"')
+}
+
+func writeLogfmt(b *bytes.Buffer, e AccessLogEntry) {
+	pairs := []struct{ k, v string }{
+		{"time", e.Time.Format(time.RFC3339)},
+		{"remote_addr", e.RemoteAddr},
+		{"user", e.User},
+		{"method", e.Method},
+		{"uri", e.URI},
+		{"proto", e.Proto},
+		{"status", strconv.Itoa(e.Status)},
+		{"bytes", strconv.FormatInt(e.Bytes, 10)},
+		{"duration", e.Duration.String()},
+		{"referer", e.Referer},
+		{"user_agent", e.UserAgent},
+		{"tracking_id", e.TrackingID},
+	}
+
+	first := true
+	for _, p := range pairs {
+		if p.v == "" {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+
+		b.WriteString(p.k)
+		b.WriteByte('=')
+		if strings.ContainsAny(p.v, " =\"\\") || strings.IndexFunc(p.v, isControl) >= 0 {
+			b.WriteString(strconv.Quote(p.v))
+		} else {
+			b.WriteString(p.v)
+		}
+	}
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// escapeCLF escapes quotes, backslashes and non printable characters as Apache does.
+func escapeCLF(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func requestUser(r *http.Request) string {
+	if r.URL.User != nil {
+		return r.URL.User.Username()
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+	entry := AccessLogEntry{
+		Time:       time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC),
+		RemoteAddr: "192.0.2.1",
+		User:       "frank",
+		Method:     http.MethodGet,
+		URI:        "/apache_pb.gif?q=\"x\"",
+		Proto:      "HTTP/1.1",
+		Status:     http.StatusOK,
+		Bytes:      2326,
+		Referer:    "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+		Duration:   1500 * time.Microsecond,
+		TrackingID: "some-id",
+	}
+
+	tcs := []struct {
+		name     string
+		cfg      AccessLogConfig
+		entry    AccessLogEntry
+		wantLine string
+	}{
+		{
+			name:     "common",
+			cfg:      AccessLogConfig{Format: FormatCommon},
+			entry:    entry,
+			wantLine: `192.0.2.1 - frank [01/Jun/2020:10:30:00 +0000] "GET /apache_pb.gif?q=\"x\" HTTP/1.1" 200 2326` + "\n",
+		},
+		{
+			name: "common no bytes no user",
+			cfg:  AccessLogConfig{Format: FormatCommon},
+			entry: AccessLogEntry{
+				Time: entry.Time, RemoteAddr: "192.0.2.1", Method: http.MethodHead,
+				URI: "/", Proto: "HTTP/1.1", Status: http.StatusNoContent},
+			wantLine: `192.0.2.1 - - [01/Jun/2020:10:30:00 +0000] "HEAD / HTTP/1.1" 204 -` + "\n",
+		},
+		{
+			name: "common user escaped",
+			cfg:  AccessLogConfig{Format: FormatCommon},
+			entry: AccessLogEntry{
+				Time: entry.Time, RemoteAddr: "192.0.2.1", User: "frank\n\"x\"", Method: http.MethodGet,
+				URI: "/", Proto: "HTTP/1.1", Status: http.StatusOK, Bytes: 2},
+			wantLine: `192.0.2.1 - frank\x0a\"x\" [01/Jun/2020:10:30:00 +0000] "GET / HTTP/1.1" 200 2` + "\n",
+		},
+		{
+			name:     "template ending in a new line",
+			cfg:      AccessLogConfig{Format: FormatTemplate, Template: "{{.Method}}\n"},
+			entry:    entry,
+			wantLine: "GET\n",
+		},
+		{
+			name:  "combined",
+			cfg:   AccessLogConfig{Format: FormatCombined},
+			entry: entry,
+			wantLine: `192.0.2.1 - frank [01/Jun/2020:10:30:00 +0000] "GET /apache_pb.gif?q=\"x\" HTTP/1.1" 200 2326 ` +
+				`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"` + "\n",
+		},
+		{
+			name:  "logfmt",
+			cfg:   AccessLogConfig{Format: FormatLogfmt},
+			entry: entry,
+			wantLine: `time=2020-06-01T10:30:00Z remote_addr=192.0.2.1 user=frank method=GET uri="/apache_pb.gif?q=\"x\"" ` +
+				`proto=HTTP/1.1 status=200 bytes=2326 duration=1.5ms referer=http://www.example.com/start.html ` +
+				`user_agent="Mozilla/4.08 [en] (Win98; I ;Nav)" tracking_id=some-id` + "\n",
+		},
+		{
+			name:     "template",
+			cfg:      AccessLogConfig{Format: FormatTemplate, Template: `{{.TrackingID}} {{.Method}} {{.Status}} {{.Duration}}`},
+			entry:    entry,
+			wantLine: "some-id GET 200 1.5ms\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := &bytes.Buffer{}
+			l, err := NewAccessLog(buff, tc.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			l.Log(tc.entry)
+			if err := l.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := buff.String(); got != tc.wantLine {
+				t.Errorf("want: %s, got: %s", tc.wantLine, got)
+			}
+		})
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	buff := &bytes.Buffer{}
+	l, err := NewAccessLog(buff, AccessLogConfig{Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users?page=2", nil)
+	r.Header.Set("User-Agent", "gopher")
+	r.SetBasicAuth("frank", "secret")
+	r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buff.Bytes(), &got); err != nil {
+		t.Fatalf("invalid log line %q: %v", buff, err)
+	}
+
+	want := map[string]interface{}{
+		"remote_addr": "192.0.2.1",
+		"user":        "frank",
+		"method":      http.MethodPost,
+		"uri":         "/users?page=2",
+		"proto":       "HTTP/1.1",
+		"status":      float64(http.StatusCreated),
+		"bytes":       float64(len("created")),
+		"user_agent":  "gopher",
+		"tracking_id": "some-id",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("want %s: %v, got: %v", k, v, got[k])
+		}
+	}
+	if _, ok := got["duration_ms"]; !ok {
+		t.Error("expected duration_ms to be logged")
+	}
+}
+
+func TestNewAccessLogInvalidTemplate(t *testing.T) {
+	_, err := NewAccessLog(&bytes.Buffer{}, AccessLogConfig{Format: FormatTemplate, Template: "{{.Status"})
+	if err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
+
+// blockingWriter blocks every Write until unblock is closed.
+type blockingWriter struct {
+	unblock chan struct{}
+
+	mu   sync.Mutex
+	buff bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buff.Write(p)
+}
+
+func TestAccessLogDropsWhenQueueIsFull(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	l, err := NewAccessLog(w, AccessLogConfig{Format: FormatTemplate, Template: "{{.Status}}", QueueSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the writer goroutine takes at most one line off the queue, so at most 3 lines
+	// are kept and at least 7 are dropped.
+	for i := 0; i < 10; i++ {
+		l.Log(AccessLogEntry{Status: http.StatusOK})
+	}
+
+	if got := l.Dropped(); got < 7 {
+		t.Errorf("want at least 7 dropped lines, got: %d", got)
+	}
+
+	close(w.unblock)
+	if err := l.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	written := strings.Count(w.buff.String(), "\n")
+	if got := uint64(written) + l.Dropped(); got != 10 {
+		t.Errorf("want written + dropped: 10, got: %d", got)
+	}
+
+	l.Log(AccessLogEntry{Status: http.StatusOK})
+	if got := uint64(written) + l.Dropped(); got != 11 {
+		t.Errorf("want lines logged after Close to be dropped, written + dropped: %d", got)
+	}
+	if err := l.Close(); err != ErrAccessLogClosed {
+		t.Errorf("want: %v, got: %v", ErrAccessLogClosed, err)
+	}
+}
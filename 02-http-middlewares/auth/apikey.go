@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the default header APIKeys reads the API key from.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeys authenticates requests by a static API key.
+type APIKeys struct {
+	header string
+	keys   []apiKey
+}
+
+type apiKey struct {
+	id   string
+	hash [sha256.Size]byte
+}
+
+// NewAPIKeys returns APIKeys accepting keys, a map of key id to key, on header,
+// APIKeyHeader if empty. The Principal ID is the key id.
+func NewAPIKeys(header string, keys map[string]string) *APIKeys {
+	if header == "" {
+		header = APIKeyHeader
+	}
+
+	a := &APIKeys{header: header}
+	for id, k := range keys {
+		a.keys = append(a.keys, apiKey{id: id, hash: sha256.Sum256([]byte(k))})
+	}
+	return a
+}
+
+// ParseAPIKeys parses entries in the "id:key" format, as in config.Config AuthAPIKeys.
+func ParseAPIKeys(entries []string) (map[string]string, error) {
+	keys := make(map[string]string, len(entries))
+	for _, e := range entries {
+		i := strings.IndexByte(e, ':')
+		if i <= 0 || i == len(e)-1 {
+			return nil, fmt.Errorf("invalid API key entry %q, want id:key", e)
+		}
+		keys[e[:i]] = e[i+1:]
+	}
+	return keys, nil
+}
+
+// Authenticate compares the request key against all keys in constant time, so the
+// response time tells nothing about the keys.
+func (a *APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	k := r.Header.Get(a.header)
+	if k == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	// comparing hashes makes the comparison independent of the keys length too
+	hash := sha256.Sum256([]byte(k))
+	var (
+		id    string
+		found bool
+	)
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			id, found = key.id, true
+		}
+	}
+
+	if !found {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return Principal{ID: id, Method: "api_key"}, nil
+}
+
+// Challenge returns the WWW-Authenticate challenge.
+func (a *APIKeys) Challenge() string {
+	return `APIKey header="` + a.header + `"`
+}
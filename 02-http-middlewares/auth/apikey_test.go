@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	got, err := ParseAPIKeys([]string{"ci:abc", "admin:x:y"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"ci": "abc", "admin": "x:y"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	for _, invalid := range []string{"no-separator", ":key", "id:"} {
+		if _, err := ParseAPIKeys([]string{invalid}); err == nil {
+			t.Errorf("%q: expected an error, got nil", invalid)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	a := NewAPIKeys("X-Key", map[string]string{"ci": "key-1", "admin": "key-2"})
+
+	tcs := []struct {
+		name    string
+		key     string
+		wantID  string
+		wantErr error
+	}{
+		{name: "first key", key: "key-1", wantID: "ci"},
+		{name: "second key", key: "key-2", wantID: "admin"},
+		{name: "unknown key", key: "key-3", wantErr: ErrInvalidCredentials},
+		{name: "prefix of a key", key: "key", wantErr: ErrInvalidCredentials},
+		{name: "no key", wantErr: ErrNoCredentials},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.key != "" {
+				r.Header.Set("X-Key", tc.key)
+			}
+
+			p, err := a.Authenticate(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tc.wantErr, err)
+			}
+			if p.ID != tc.wantID {
+				t.Errorf("want principal: %q, got: %q", tc.wantID, p.ID)
+			}
+		})
+	}
+}
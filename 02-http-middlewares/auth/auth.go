@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request carries no credentials
+	// it understands, so the next Authenticator is tried.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned, usually wrapped, when the credentials are wrong.
+	// It's answered with 401 Unauthorized.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden is returned, usually wrapped, when the credentials are right but not allowed.
+	// It's answered with 403 Forbidden.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is an authenticated client.
+type Principal struct {
+	// ID identifies the client, e.g. the API key id, the user name or the JWT subject.
+	ID string
+	// Method is the authentication method, e.g. "api_key", "hmac", "jwt" or "basic".
+	Method string
+	// Scopes the client was granted.
+	Scopes []string
+	// Claims are the JWT claims, nil for other methods.
+	Claims map[string]interface{}
+}
+
+// HasScope reports whether p was granted scope.
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type key struct{}
+
+var ctxKey = key{}
+
+// ContextWithPrincipal returns a copy of ctx carrying p.
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey, p)
+}
+
+// PrincipalFromContext returns the Principal in ctx, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey).(Principal)
+	return p, ok
+}
+
+// Authenticator authenticates requests. It returns ErrNoCredentials if r carries no credentials
+// for it, or an error wrapping ErrInvalidCredentials or ErrForbidden if they are not accepted.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as Authenticator.
+type AuthenticatorFunc func(r *http.Request) (Principal, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Principal, error) {
+	return f(r)
+}
+
+// challenger is implemented by the Authenticators with a WWW-Authenticate challenge.
+type challenger interface {
+	Challenge() string
+}
+
+// Middleware returns a middleware which authenticates the requests with the first of
+// authenticators finding credentials on it, and adds the Principal to the request context.
+// Requests without credentials, or with invalid ones, get 401 Unauthorized with the
+// authenticators challenges on WWW-Authenticate. Forbidden ones get 403 Forbidden and
+// the ones failing too often, see Htpasswd, 429 Too Many Requests. All with a JSON error
+// body carrying the tracking id.
+func Middleware(authenticators ...Authenticator) func(next http.Handler) http.Handler {
+	var challenges []string
+	for _, a := range authenticators {
+		if c, ok := a.(challenger); ok {
+			challenges = append(challenges, c.Challenge())
+		}
+	}
+	challenge := strings.Join(challenges, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					writeError(w, r, challenge, err)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+				return
+			}
+
+			writeError(w, r, challenge, ErrNoCredentials)
+		})
+	}
+}
+
+// RequireScope returns a middleware which only lets through the requests whose Principal was
+// granted all scopes. The others get 403 Forbidden, or 401 Unauthorized if not authenticated.
+func RequireScope(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				writeError(w, r, "", ErrNoCredentials)
+				return
+			}
+
+			for _, s := range scopes {
+				if !p.HasScope(s) {
+					writeError(w, r, "", fmt.Errorf("missing scope %s: %w", s, ErrForbidden))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, challenge string, err error) {
+	if errors.Is(err, ErrForbidden) {
+		tracking.WriteJSONError(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var attemptsErr tooManyAttemptsError
+	if errors.As(err, &attemptsErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(attemptsErr.retryAfter.Seconds()))))
+	}
+	if errors.Is(err, ErrTooManyAttempts) {
+		tracking.WriteJSONError(w, r, http.StatusTooManyRequests, err.Error())
+		return
+	}
+
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	tracking.WriteJSONError(w, r, http.StatusUnauthorized, err.Error())
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+func TestMiddleware(t *testing.T) {
+	apiKeys := NewAPIKeys("", map[string]string{"ci": "secret-key"})
+	forbidden := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		if r.Header.Get("X-Blocked") == "" {
+			return Principal{}, ErrNoCredentials
+		}
+		return Principal{}, fmt.Errorf("%w: blocked", ErrForbidden)
+	})
+
+	tcs := []struct {
+		name          string
+		headers       map[string]string
+		wantStatus    int
+		wantPrincipal string
+		wantChallenge string
+	}{
+		{
+			name:          "valid key",
+			headers:       map[string]string{APIKeyHeader: "secret-key"},
+			wantStatus:    http.StatusOK,
+			wantPrincipal: "ci",
+		},
+		{
+			name:          "invalid key",
+			headers:       map[string]string{APIKeyHeader: "wrong"},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `APIKey header="X-API-Key"`,
+		},
+		{
+			name:          "no credentials",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `APIKey header="X-API-Key"`,
+		},
+		{
+			name:       "forbidden",
+			headers:    map[string]string{"X-Blocked": "yes"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var principal Principal
+			h := Middleware(apiKeys, forbidden)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if principal.ID != tc.wantPrincipal {
+				t.Errorf("want principal: %q, got: %q", tc.wantPrincipal, principal.ID)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tc.wantChallenge {
+				t.Errorf("want WWW-Authenticate: %q, got: %q", tc.wantChallenge, got)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				var body tracking.ErrorBody
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid error body %q: %v", w.Body, err)
+				}
+				if body.TrackingID != "some-id" {
+					t.Errorf("want tracking_id: some-id, got: %q", body.TrackingID)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tcs := []struct {
+		name       string
+		principal  *Principal
+		wantStatus int
+	}{
+		{name: "granted", principal: &Principal{ID: "a", Scopes: []string{"read", "write"}}, wantStatus: http.StatusOK},
+		{name: "missing scope", principal: &Principal{ID: "a", Scopes: []string{"read"}}, wantStatus: http.StatusForbidden},
+		{name: "not authenticated", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h := RequireScope("read", "write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.principal != nil {
+				r = r.WithContext(ContextWithPrincipal(r.Context(), *tc.principal))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers carrying the HMAC request signature, see SignRequest.
+const (
+	HMACKeyIDHeader     = "X-Auth-Key-Id"
+	HMACTimestampHeader = "X-Auth-Timestamp"
+	HMACSignatureHeader = "X-Auth-Signature"
+)
+
+// HMACConfig configures HMACSigned.
+type HMACConfig struct {
+	// Keys maps the key ids to their secrets.
+	Keys map[string][]byte
+	// Window is how far off the request timestamp can be, either way, defaults to 5 minutes.
+	// Signatures are remembered within it, so a signed request cannot be replayed.
+	Window time.Duration
+	// MaxBodyBytes is the largest body verified, defaults to 10MB.
+	MaxBodyBytes int64
+}
+
+// HMACSigned authenticates requests signed with a shared secret, see SignRequest.
+type HMACSigned struct {
+	cfg HMACConfig
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// NewHMACSigned returns a HMACSigned accepting requests signed with cfg.Keys.
+func NewHMACSigned(cfg HMACConfig) *HMACSigned {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 10 << 20
+	}
+
+	return &HMACSigned{cfg: cfg, seen: map[string]time.Time{}, now: time.Now}
+}
+
+// ParseHMACKeys parses entries in the "id:secret" format, as in config.Config AuthHMACKeys.
+func ParseHMACKeys(entries []string) (map[string][]byte, error) {
+	keys, err := ParseAPIKeys(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string][]byte, len(keys))
+	for id, k := range keys {
+		secrets[id] = []byte(k)
+	}
+	return secrets, nil
+}
+
+// SignRequest signs r with the secret of keyID at t. The signature is the hex encoded
+// HMAC-SHA256 of the method, the request URI, the unix timestamp and the hex encoded
+// SHA-256 of the body, separated by new lines. r.Body is read and replaced.
+func SignRequest(r *http.Request, keyID string, secret []byte, t time.Time) error {
+	body, err := readBody(r, -1)
+	if err != nil {
+		return fmt.Errorf("could not sign request: %w", err)
+	}
+
+	ts := strconv.FormatInt(t.Unix(), 10)
+	r.Header.Set(HMACKeyIDHeader, keyID)
+	r.Header.Set(HMACTimestampHeader, ts)
+	r.Header.Set(HMACSignatureHeader, hex.EncodeToString(signature(r, ts, body, secret)))
+
+	return nil
+}
+
+func (a *HMACSigned) Authenticate(r *http.Request) (Principal, error) {
+	keyID := r.Header.Get(HMACKeyIDHeader)
+	ts := r.Header.Get(HMACTimestampHeader)
+	sig := r.Header.Get(HMACSignatureHeader)
+	if keyID == "" && ts == "" && sig == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	secret, ok := a.cfg.Keys[keyID]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown key id", ErrInvalidCredentials)
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: invalid timestamp", ErrInvalidCredentials)
+	}
+	now := a.now()
+	if d := now.Sub(time.Unix(unix, 0)); d > a.cfg.Window || d < -a.cfg.Window {
+		return Principal{}, fmt.Errorf("%w: timestamp out of the accepted window", ErrInvalidCredentials)
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: invalid signature", ErrInvalidCredentials)
+	}
+
+	body, err := readBody(r, a.cfg.MaxBodyBytes)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if !hmac.Equal(got, signature(r, ts, body, secret)) {
+		return Principal{}, fmt.Errorf("%w: signature mismatch", ErrInvalidCredentials)
+	}
+
+	// keyed on the decoded signature, hex in another case is the same signature
+	if a.replayed(keyID+":"+hex.EncodeToString(got), now) {
+		return Principal{}, fmt.Errorf("%w: replayed request", ErrInvalidCredentials)
+	}
+
+	return Principal{ID: keyID, Method: "hmac"}, nil
+}
+
+// Challenge returns the WWW-Authenticate challenge.
+func (a *HMACSigned) Challenge() string {
+	return "HMAC-SHA256"
+}
+
+// replayed records sig and reports whether it was seen within the window.
+func (a *HMACSigned) replayed(sig string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.lastSweep) >= a.cfg.Window {
+		for s, expiry := range a.seen {
+			if now.After(expiry) {
+				delete(a.seen, s)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	if expiry, ok := a.seen[sig]; ok && !now.After(expiry) {
+		return true
+	}
+	// the timestamp can be up to a window in the future, remember it for two
+	a.seen[sig] = now.Add(2 * a.cfg.Window)
+	return false
+}
+
+func signature(r *http.Request, ts string, body, secret []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	_, _ = io.WriteString(mac, strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		ts,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n"))
+	return mac.Sum(nil)
+}
+
+// readBody reads r.Body, up to max bytes if max >= 0, and replaces it so it can be read again.
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	var src io.Reader = r.Body
+	if max >= 0 {
+		src = io.LimitReader(r.Body, max+1)
+	}
+	body, err := ioutil.ReadAll(src)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read body: %w", err)
+	}
+	if max >= 0 && int64(len(body)) > max {
+		return nil, fmt.Errorf("body larger than %d bytes", max)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
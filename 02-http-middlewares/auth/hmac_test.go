@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACSigned(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	secret := []byte("s3cr3t")
+
+	tcs := []struct {
+		name    string
+		sign    func(r *http.Request)
+		tamper  func(r *http.Request)
+		wantErr error
+	}{
+		{
+			name: "valid",
+			sign: func(r *http.Request) { _ = SignRequest(r, "ci", secret, now) },
+		},
+		{
+			name: "within the window",
+			sign: func(r *http.Request) { _ = SignRequest(r, "ci", secret, now.Add(-4*time.Minute)) },
+		},
+		{
+			name:    "not signed",
+			sign:    func(r *http.Request) {},
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name:    "too old",
+			sign:    func(r *http.Request) { _ = SignRequest(r, "ci", secret, now.Add(-6*time.Minute)) },
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "from the future",
+			sign:    func(r *http.Request) { _ = SignRequest(r, "ci", secret, now.Add(6*time.Minute)) },
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "unknown key",
+			sign:    func(r *http.Request) { _ = SignRequest(r, "other", secret, now) },
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "wrong secret",
+			sign:    func(r *http.Request) { _ = SignRequest(r, "ci", []byte("wrong"), now) },
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "tampered body",
+			sign: func(r *http.Request) { _ = SignRequest(r, "ci", secret, now) },
+			tamper: func(r *http.Request) {
+				r.Body = ioutil.NopCloser(strings.NewReader(`{"amount":1000}`))
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "tampered query",
+			sign:    func(r *http.Request) { _ = SignRequest(r, "ci", secret, now) },
+			tamper:  func(r *http.Request) { r.URL.RawQuery = "to=eve" },
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewHMACSigned(HMACConfig{Keys: map[string][]byte{"ci": secret}})
+			a.now = func() time.Time { return now }
+
+			r := httptest.NewRequest(http.MethodPost, "/transfers?to=bob", strings.NewReader(`{"amount":10}`))
+			tc.sign(r)
+			if tc.tamper != nil {
+				tc.tamper(r)
+			}
+
+			p, err := a.Authenticate(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if p.ID != "ci" || p.Method != "hmac" {
+				t.Errorf("want principal ci authenticated by hmac, got: %+v", p)
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != `{"amount":10}` {
+				t.Errorf("want the body readable after verification, got: %q", body)
+			}
+		})
+	}
+}
+
+func TestHMACSignedRejectsReplays(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	a := NewHMACSigned(HMACConfig{Keys: map[string][]byte{"ci": []byte("s3cr3t")}})
+	a.now = func() time.Time { return now }
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := SignRequest(r, "ci", []byte("s3cr3t"), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := a.Authenticate(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("want replay rejected with: %v, got: %v", ErrInvalidCredentials, err)
+	}
+
+	r.Header.Set(HMACSignatureHeader, strings.ToUpper(r.Header.Get(HMACSignatureHeader)))
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("want replay with an upper case signature rejected with: %v, got: %v", ErrInvalidCredentials, err)
+	}
+}
+
+func TestHMACSignedMaxBodyBytes(t *testing.T) {
+	now := time.Now()
+	a := NewHMACSigned(HMACConfig{Keys: map[string][]byte{"ci": []byte("s3cr3t")}, MaxBodyBytes: 4})
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large"))
+	if err := SignRequest(r, "ci", []byte("s3cr3t"), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("want: %v, got: %v", ErrInvalidCredentials, err)
+	}
+}
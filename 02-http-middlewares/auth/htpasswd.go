@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrTooManyAttempts is returned, usually wrapped, when a client failed to authenticate too
+// many times. It's answered with 429 Too Many Requests.
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+// tooManyAttemptsError is ErrTooManyAttempts with how long until the client can try again.
+type tooManyAttemptsError struct {
+	retryAfter time.Duration
+}
+
+func (e tooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyAttempts, e.retryAfter)
+}
+
+func (e tooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// HtpasswdConfig configures Htpasswd.
+type HtpasswdConfig struct {
+	// Path of the htpasswd file.
+	Path string
+	// ReloadInterval is how often the file modification time is checked, defaults to 5s.
+	ReloadInterval time.Duration
+	// MaxFailures is how many failed attempts a user can make in a row, defaults to 5.
+	// After that a new attempt is allowed every FailureWindow / MaxFailures.
+	MaxFailures int
+	// FailureWindow is how long it takes to forget MaxFailures failed attempts, defaults to 1 minute.
+	FailureWindow time.Duration
+	// Realm sent on the WWW-Authenticate challenge, defaults to "Restricted".
+	Realm string
+	// Logger the outcome of each attempt and the reloads are logged to, e.g. config.Logger().
+	Logger zerolog.Logger
+}
+
+// Htpasswd authenticates requests with HTTP Basic authentication against an Apache htpasswd
+// file with bcrypt hashes, e.g. created with `htpasswd -B`. Entries with other hashes are
+// ignored. The file is reloaded when it changes, without a restart.
+//
+// Failed attempts are rate limited per user. Once they run out the user gets
+// ErrTooManyAttempts, without even checking the password, until the limit allows again.
+// Successful logins are not counted and forget the user's failed attempts.
+type Htpasswd struct {
+	cfg      HtpasswdConfig
+	failures *ratelimit.Limiter
+
+	// attempts serialises the attempts of each user, see lockUser.
+	attemptsMu sync.Mutex
+	attempts   map[string]*userAttempts
+
+	mu      sync.RWMutex
+	users   map[string][]byte
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// getDummyHash returns the hash compared against when the user does not exist, so the
+// response time does not tell whether it does.
+func getDummyHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// NewHtpasswd loads the htpasswd file on cfg.Path and starts watching it for changes.
+// Call Close to stop watching.
+func NewHtpasswd(cfg HtpasswdConfig) (*Htpasswd, error) {
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = 5 * time.Second
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = time.Minute
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = "Restricted"
+	}
+
+	h := &Htpasswd{
+		cfg: cfg,
+		failures: ratelimit.New(ratelimit.Config{
+			Rate:  float64(cfg.MaxFailures) / cfg.FailureWindow.Seconds(),
+			Burst: cfg.MaxFailures,
+		}),
+		attempts: map[string]*userAttempts{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+
+	go h.watch()
+
+	return h, nil
+}
+
+// Reload loads the htpasswd file again. On error the users loaded before are kept.
+func (h *Htpasswd) Reload() error {
+	info, err := os.Stat(h.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("could not load htpasswd file: %w", err)
+	}
+	b, err := ioutil.ReadFile(h.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("could not load htpasswd file: %w", err)
+	}
+
+	users := map[string][]byte{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return fmt.Errorf("invalid htpasswd file %s: line %d is not user:hash", h.cfg.Path, n)
+		}
+		user, hash := line[:i], line[i+1:]
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			h.cfg.Logger.Warn().Str("path", h.cfg.Path).Int("line", n).Str("user", user).
+				Msg("ignoring htpasswd entry, only bcrypt hashes are supported")
+			continue
+		}
+		users[user] = []byte(hash)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("could not read htpasswd file: %w", err)
+	}
+
+	h.mu.Lock()
+	h.users = users
+	h.modTime = info.ModTime()
+	h.size = info.Size()
+	h.mu.Unlock()
+
+	h.cfg.Logger.Info().Str("path", h.cfg.Path).Int("users", len(users)).Msg("htpasswd file loaded")
+	return nil
+}
+
+// Close stops watching the htpasswd file.
+func (h *Htpasswd) Close() error {
+	select {
+	case <-h.stop:
+	default:
+		close(h.stop)
+	}
+	<-h.done
+	return nil
+}
+
+func (h *Htpasswd) watch() {
+	defer close(h.done)
+
+	t := time.NewTicker(h.cfg.ReloadInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-t.C:
+		}
+
+		info, err := os.Stat(h.cfg.Path)
+		if err != nil {
+			h.cfg.Logger.Error().Err(err).Str("path", h.cfg.Path).Msg("could not check htpasswd file")
+			continue
+		}
+
+		h.mu.RLock()
+		changed := !info.ModTime().Equal(h.modTime) || info.Size() != h.size
+		h.mu.RUnlock()
+
+		if changed {
+			if err := h.Reload(); err != nil {
+				h.cfg.Logger.Error().Err(err).Str("path", h.cfg.Path).Msg("could not reload htpasswd file, keeping the previous users")
+			}
+		}
+	}
+}
+
+// Authenticate checks the request Basic credentials against the htpasswd users.
+func (h *Htpasswd) Authenticate(r *http.Request) (Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	log := func(e *zerolog.Event) *zerolog.Event {
+		return e.Str("tracking_id", tracking.IdFromContext(r.Context())).
+			Str("user", user).
+			Str("remote_addr", r.RemoteAddr)
+	}
+
+	// the attempts of a user are serialised, so the attempt can be charged before checking the
+	// password and given back on success, counting only the failures. Otherwise concurrent
+	// guesses would all get through before the first failure is counted.
+	unlock := h.lockUser(user)
+	defer unlock()
+
+	if res := h.failures.Take(user); !res.Allowed {
+		log(h.cfg.Logger.Warn()).Msg("basic auth rejected, too many failed attempts")
+		return Principal{}, tooManyAttemptsError{retryAfter: res.RetryAfter}
+	}
+
+	h.mu.RLock()
+	hash, found := h.users[user]
+	h.mu.RUnlock()
+	if !found {
+		hash = getDummyHash()
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !found {
+		log(h.cfg.Logger.Warn()).Bool("known_user", found).Msg("basic auth failed")
+		return Principal{}, fmt.Errorf("%w: wrong user or password", ErrInvalidCredentials)
+	}
+
+	h.failures.Reset(user)
+	log(h.cfg.Logger.Info()).Msg("basic auth succeeded")
+	return Principal{ID: user, Method: "basic"}, nil
+}
+
+// userAttempts is the lock serialising the attempts of a user and how many are holding or
+// waiting for it.
+type userAttempts struct {
+	mu sync.Mutex
+	n  int
+}
+
+// lockUser blocks until no other attempt of user is running and returns the function
+// releasing it. The lock is dropped once no attempt needs it, so it does not outlive them.
+func (h *Htpasswd) lockUser(user string) (unlock func()) {
+	h.attemptsMu.Lock()
+	a, ok := h.attempts[user]
+	if !ok {
+		a = &userAttempts{}
+		h.attempts[user] = a
+	}
+	a.n++
+	h.attemptsMu.Unlock()
+
+	a.mu.Lock()
+	return func() {
+		a.mu.Unlock()
+
+		h.attemptsMu.Lock()
+		a.n--
+		if a.n == 0 {
+			delete(h.attempts, user)
+		}
+		h.attemptsMu.Unlock()
+	}
+}
+
+// Challenge returns the WWW-Authenticate challenge.
+func (h *Htpasswd) Challenge() string {
+	return `Basic realm="` + h.cfg.Realm + `", charset="UTF-8"`
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func htpasswdLine(t *testing.T, user, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("could not hash password: %v", err)
+	}
+	return user + ":" + string(hash) + "\n"
+}
+
+func writeHtpasswd(t *testing.T, path string, lines ...string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0600); err != nil {
+		t.Fatalf("could not write htpasswd file: %v", err)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path,
+		"# admins\n",
+		htpasswdLine(t, "admin", "s3cr3t"),
+		"legacy:$apr1$lZL6V/ci$eIMz/iKDkbtys/uU7LEK00\n",
+	)
+
+	h, err := NewHtpasswd(HtpasswdConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	tcs := []struct {
+		name     string
+		user     string
+		password string
+		wantErr  error
+	}{
+		{name: "valid", user: "admin", password: "s3cr3t"},
+		{name: "wrong password", user: "admin", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", user: "gopher", password: "s3cr3t", wantErr: ErrInvalidCredentials},
+		{name: "not bcrypt", user: "legacy", password: "s3cr3t", wantErr: ErrInvalidCredentials},
+		{name: "no credentials", wantErr: ErrNoCredentials},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tc.user != "" {
+				r.SetBasicAuth(tc.user, tc.password)
+			}
+
+			p, err := h.Authenticate(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if p.ID != tc.user || p.Method != "basic" {
+				t.Errorf("want principal %s authenticated by basic, got: %+v", tc.user, p)
+			}
+		})
+	}
+}
+
+func TestNewHtpasswdInvalidFile(t *testing.T) {
+	dir := tempDir(t)
+
+	if _, err := NewHtpasswd(HtpasswdConfig{Path: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("missing file: expected an error, got nil")
+	}
+
+	path := filepath.Join(dir, ".htpasswd")
+	writeHtpasswd(t, path, "no-separator\n")
+	if _, err := NewHtpasswd(HtpasswdConfig{Path: path}); err == nil {
+		t.Error("malformed file: expected an error, got nil")
+	}
+}
+
+func TestHtpasswdReload(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path, htpasswdLine(t, "admin", "s3cr3t"))
+
+	h, err := NewHtpasswd(HtpasswdConfig{Path: path, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	writeHtpasswd(t, path,
+		htpasswdLine(t, "admin", "s3cr3t"),
+		htpasswdLine(t, "gopher", "g0pher"),
+	)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mu.RLock()
+		_, reloaded := h.users["gopher"]
+		h.mu.RUnlock()
+		if reloaded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want the file reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.SetBasicAuth("gopher", "g0pher")
+	if _, err := h.Authenticate(r); err != nil {
+		t.Errorf("want the new user accepted after the reload, got: %v", err)
+	}
+}
+
+func TestHtpasswdLimitsFailedAttempts(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path, htpasswdLine(t, "admin", "s3cr3t"))
+
+	logs := &bytes.Buffer{}
+	h, err := NewHtpasswd(HtpasswdConfig{
+		Path:          path,
+		MaxFailures:   2,
+		FailureWindow: time.Minute,
+		Logger:        zerolog.New(logs),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	handler := Middleware(h)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "a-tracking-id"))
+		r.SetBasicAuth("admin", password)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := serve("wrong")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: want status: %d, got: %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, `Basic realm="Restricted"`) {
+			t.Errorf("want a Basic challenge, got: %q", got)
+		}
+	}
+
+	w := serve("s3cr3t")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("want status: %d, got: %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("want Retry-After: 30, got: %q", got)
+	}
+
+	if !strings.Contains(logs.String(), `"tracking_id":"a-tracking-id"`) {
+		t.Errorf("want the tracking id logged, got: %s", logs)
+	}
+	if !strings.Contains(logs.String(), "basic auth failed") {
+		t.Errorf("want the failed attempts logged, got: %s", logs)
+	}
+}
+
+func TestHtpasswdLimitsConcurrentAttempts(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path, htpasswdLine(t, "admin", "s3cr3t"))
+
+	h, err := NewHtpasswd(HtpasswdConfig{Path: path, MaxFailures: 2, FailureWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	const n = 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			r.SetBasicAuth("admin", "wrong")
+			_, err := h.Authenticate(r)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var limited int
+	for err := range errs {
+		if errors.Is(err, ErrTooManyAttempts) {
+			limited++
+		}
+	}
+	if want := n - 2; limited != want {
+		t.Errorf("want %d attempts limited, got: %d", want, limited)
+	}
+}
+
+func TestHtpasswdConcurrentLogins(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path, htpasswdLine(t, "admin", "s3cr3t"))
+
+	h, err := NewHtpasswd(HtpasswdConfig{Path: path, MaxFailures: 2, FailureWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	const n = 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			r.SetBasicAuth("admin", "s3cr3t")
+			_, err := h.Authenticate(r)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if len(h.attempts) != 0 {
+		t.Errorf("want no attempt locks left, got: %d", len(h.attempts))
+	}
+}
+
+func TestHtpasswdSuccessForgetsFailures(t *testing.T) {
+	path := filepath.Join(tempDir(t), ".htpasswd")
+	writeHtpasswd(t, path, htpasswdLine(t, "admin", "s3cr3t"))
+
+	h, err := NewHtpasswd(HtpasswdConfig{Path: path, MaxFailures: 2, FailureWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer h.Close()
+
+	auth := func(password string) error {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		r.SetBasicAuth("admin", password)
+		_, err := h.Authenticate(r)
+		return err
+	}
+
+	for _, password := range []string{"wrong", "s3cr3t", "wrong", "wrong"} {
+		if err := auth(password); errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("want the failures before the login forgotten, got: %v", err)
+		}
+	}
+	if err := auth("s3cr3t"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("want: %v, got: %v", ErrTooManyAttempts, err)
+	}
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned, wrapping ErrInvalidCredentials, for malformed or unverifiable JWTs.
+var ErrInvalidToken = fmt.Errorf("%w: invalid token", ErrInvalidCredentials)
+
+// JWTConfig configures JWT.
+type JWTConfig struct {
+	// HMACKeys are the HS256 secrets by key id. A token without key id is verified with
+	// the only key, if there is just one.
+	HMACKeys map[string][]byte
+	// RSAKeys are the RS256 public keys by key id, see LoadJWKSFile and LoadRSAPublicKeyFile.
+	RSAKeys map[string]*rsa.PublicKey
+	// Issuer, if set, must match the iss claim.
+	Issuer string
+	// Audience, if set, must be in the aud claim.
+	Audience string
+	// Leeway is the clock skew tolerated on exp, nbf and iat, defaults to 1 minute.
+	// A negative Leeway tolerates none.
+	Leeway time.Duration
+	// AllowNoExpiry accepts tokens without the exp claim, which never expire.
+	// By default they are rejected.
+	AllowNoExpiry bool
+}
+
+// JWT authenticates requests with a JSON Web Token signed with HS256 or RS256 on the
+// Authorization header as a Bearer token. The algorithm must match the type of the key,
+// so an RSA public key is never used as an HMAC secret.
+//
+// The Principal ID is the sub claim and its scopes come from the scope claim, a space
+// separated list, or the scp claim, a list.
+type JWT struct {
+	cfg JWTConfig
+	now func() time.Time
+}
+
+// NewJWT returns a JWT verifying tokens with cfg keys. It returns an error if there are none.
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	if len(cfg.HMACKeys) == 0 && len(cfg.RSAKeys) == 0 {
+		return nil, errors.New("JWT authentication needs at least one key")
+	}
+	switch {
+	case cfg.Leeway == 0:
+		cfg.Leeway = time.Minute
+	case cfg.Leeway < 0:
+		cfg.Leeway = 0
+	}
+
+	return &JWT{cfg: cfg, now: time.Now}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (j *JWT) Authenticate(r *http.Request) (Principal, error) {
+	authz := r.Header.Get("Authorization")
+	if len(authz) < 7 || !strings.EqualFold(authz[:7], "Bearer ") {
+		return Principal{}, ErrNoCredentials
+	}
+
+	claims, err := j.Verify(strings.TrimSpace(authz[7:]))
+	if err != nil {
+		return Principal{}, err
+	}
+
+	p := Principal{Method: "jwt", Claims: claims}
+	p.ID, _ = claims["sub"].(string)
+	if scopes, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scopes {
+			if s, ok := s.(string); ok {
+				p.Scopes = append(p.Scopes, s)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = append(p.Scopes, strings.Fields(scope)...)
+	}
+
+	return p, nil
+}
+
+// Challenge returns the WWW-Authenticate challenge.
+func (j *JWT) Challenge() string {
+	return "Bearer"
+}
+
+// Verify verifies token and returns its claims.
+func (j *JWT) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: want 3 parts, got %d", ErrInvalidToken, len(parts))
+	}
+
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch h.Alg {
+	case "HS256":
+		key, ok := j.hmacKey(h.Kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown HS256 key %q", ErrInvalidToken, h.Kid)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "RS256":
+		key, ok := j.rsaKey(h.Kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown RS256 key %q", ErrInvalidToken, h.Kid)
+		}
+		hash := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := j.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (j *JWT) validateClaims(claims map[string]interface{}) error {
+	now := j.now()
+
+	exp, ok, err := timeClaim(claims, "exp")
+	switch {
+	case err != nil:
+		return err
+	case ok:
+		if now.After(exp.Add(j.cfg.Leeway)) {
+			return fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+		}
+	case !j.cfg.AllowNoExpiry:
+		return fmt.Errorf("%w: token without expiry", ErrInvalidCredentials)
+	}
+	nbf, ok, err := timeClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(j.cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidCredentials)
+	}
+	iat, ok, err := timeClaim(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(j.cfg.Leeway).Before(iat) {
+		return fmt.Errorf("%w: token issued in the future", ErrInvalidCredentials)
+	}
+
+	if j.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.cfg.Issuer {
+			return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredentials, iss)
+		}
+	}
+	if j.cfg.Audience != "" && !hasAudience(claims["aud"], j.cfg.Audience) {
+		return fmt.Errorf("%w: token not for audience %q", ErrInvalidCredentials, j.cfg.Audience)
+	}
+
+	return nil
+}
+
+func (j *JWT) hmacKey(kid string) ([]byte, bool) {
+	if kid == "" && len(j.cfg.HMACKeys) == 1 {
+		for _, k := range j.cfg.HMACKeys {
+			return k, true
+		}
+	}
+	k, ok := j.cfg.HMACKeys[kid]
+	return k, ok
+}
+
+func (j *JWT) rsaKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(j.cfg.RSAKeys) == 1 {
+		for _, k := range j.cfg.RSAKeys {
+			return k, true
+		}
+	}
+	k, ok := j.cfg.RSAKeys[kid]
+	return k, ok
+}
+
+func hasAudience(aud interface{}, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []interface{}:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxUnixSeconds is the largest NumericDate, in seconds, that fits an int64 of nanoseconds.
+const maxUnixSeconds = math.MaxInt64 / int64(time.Second)
+
+// timeClaim returns the NumericDate claim name, and whether claims has it. Numbers that are not
+// within ±maxUnixSeconds are invalid, they would overflow once in nanoseconds.
+func timeClaim(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok || v == nil {
+		return time.Time{}, false, nil
+	}
+
+	secs, ok := v.(float64)
+	if !ok || math.IsNaN(secs) || math.Abs(secs) > float64(maxUnixSeconds) {
+		return time.Time{}, false, fmt.Errorf("%w: invalid %s claim", ErrInvalidCredentials, name)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), true, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// LoadJWKSFile loads the RSA keys, by key id, of the JSON Web Key Set on path.
+// Keys of other types are ignored.
+func LoadJWKSFile(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read JWKS: %w", err)
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses the RSA keys, by key id, of the JSON Web Key Set jwks.
+// Keys of other types are ignored.
+func ParseJWKS(jwks []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q exponent: %w", k.Kid, err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid JWKS key %q exponent", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	}
+
+	return keys, nil
+}
+
+// LoadRSAPublicKeyFile loads a PEM encoded RSA public key, PKIX or PKCS #1.
+func LoadRSAPublicKeyFile(path string) (*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read RSA public key: %w", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found on %s", path)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an RSA public key", path)
+		}
+		return rsaKey, nil
+	}
+}
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func signHS256(t *testing.T, kid string, claims map[string]interface{}, secret []byte) string {
+	t.Helper()
+
+	signed := encodeSegments(t, map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid}, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, kid string, claims map[string]interface{}, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	signed := encodeSegments(t, map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}, claims)
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatalf("could not sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeSegments(t *testing.T, header map[string]string, claims map[string]interface{}) string {
+	t.Helper()
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("could not encode header: %v", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("could not encode claims: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": "ignored"},
+			{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+	b, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("could not encode JWKS: %v", err)
+	}
+
+	path := filepath.Join(tempDir(t), "jwks.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("could not write JWKS: %v", err)
+	}
+	return path
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	rsaKeys, err := LoadJWKSFile(writeJWKS(t, "rsa-1", &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rsaKeys) != 1 {
+		t.Fatalf("want 1 RSA key from the JWKS, got: %d", len(rsaKeys))
+	}
+
+	secret := []byte("hs256-secret")
+	j, err := NewJWT(JWTConfig{
+		HMACKeys: map[string][]byte{"hs-1": secret},
+		RSAKeys:  rsaKeys,
+		Issuer:   "https://issuer.example",
+		Audience: "orders",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	j.now = func() time.Time { return testNow }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "gopher",
+			"iss":   "https://issuer.example",
+			"aud":   []string{"billing", "orders"},
+			"exp":   testNow.Add(time.Hour).Unix(),
+			"iat":   testNow.Unix(),
+			"scope": "orders:read orders:write",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	rsaPublicDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+
+	tcs := []struct {
+		name    string
+		authz   string
+		wantErr error
+	}{
+		{name: "HS256", authz: "Bearer " + signHS256(t, "hs-1", claims(nil), secret)},
+		{name: "HS256 without kid", authz: "bearer " + signHS256(t, "", claims(nil), secret)},
+		{name: "RS256", authz: "Bearer " + signRS256(t, "rsa-1", claims(nil), rsaKey)},
+		{name: "no token", wantErr: ErrNoCredentials},
+		{name: "basic auth", authz: "Basic Z29waGVyOnB3ZA==", wantErr: ErrNoCredentials},
+		{name: "malformed", authz: "Bearer not-a-jwt", wantErr: ErrInvalidToken},
+		{name: "wrong secret", authz: "Bearer " + signHS256(t, "hs-1", claims(nil), []byte("wrong")), wantErr: ErrInvalidToken},
+		{name: "unknown kid", authz: "Bearer " + signRS256(t, "rsa-2", claims(nil), rsaKey), wantErr: ErrInvalidToken},
+		{
+			name:    "RSA public key used as HMAC secret",
+			authz:   "Bearer " + signHS256(t, "rsa-1", claims(nil), rsaPublicDER),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "alg none",
+			authz:   "Bearer " + encodeSegments(t, map[string]string{"alg": "none"}, claims(nil)) + ".",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "expired",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"exp": testNow.Add(-2 * time.Minute).Unix()}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:  "expired within leeway",
+			authz: "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"exp": testNow.Add(-30 * time.Second).Unix()}), secret),
+		},
+		{
+			name:    "no expiry",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"exp": nil}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "invalid expiry",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"exp": "tomorrow"}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "not valid yet",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"nbf": testNow.Add(time.Hour).Unix()}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "nbf overflowing int64 nanoseconds",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"nbf": 1e19}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "exp overflowing int64 nanoseconds",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"exp": 1e300}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "wrong issuer",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"iss": "https://evil.example"}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "wrong audience",
+			authz:   "Bearer " + signHS256(t, "hs-1", claims(map[string]interface{}{"aud": "billing"}), secret),
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.authz != "" {
+				r.Header.Set("Authorization", tc.authz)
+			}
+
+			p, err := j.Authenticate(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if p.ID != "gopher" || p.Method != "jwt" {
+				t.Errorf("want principal gopher authenticated by jwt, got: %+v", p)
+			}
+			if want := []string{"orders:read", "orders:write"}; !reflect.DeepEqual(p.Scopes, want) {
+				t.Errorf("want scopes: %v, got: %v", want, p.Scopes)
+			}
+		})
+	}
+}
+
+func TestJWTExpiryOptions(t *testing.T) {
+	secret := []byte("hs256-secret")
+	token := func(exp interface{}) string {
+		claims := map[string]interface{}{"sub": "gopher"}
+		if exp != nil {
+			claims["exp"] = exp
+		}
+		return signHS256(t, "", claims, secret)
+	}
+
+	tcs := []struct {
+		name    string
+		cfg     JWTConfig
+		token   string
+		wantErr error
+	}{
+		{name: "no expiry allowed", cfg: JWTConfig{AllowNoExpiry: true}, token: token(nil)},
+		{
+			name:    "invalid expiry with no expiry allowed",
+			cfg:     JWTConfig{AllowNoExpiry: true},
+			token:   token("tomorrow"),
+			wantErr: ErrInvalidCredentials,
+		},
+		{name: "no leeway, expires now", cfg: JWTConfig{Leeway: -1}, token: token(testNow.Unix())},
+		{
+			name:    "no leeway, expired a second ago",
+			cfg:     JWTConfig{Leeway: -1},
+			token:   token(testNow.Add(-time.Second).Unix()),
+			wantErr: ErrInvalidCredentials,
+		},
+		{name: "default leeway, expired a second ago", token: token(testNow.Add(-time.Second).Unix())},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.HMACKeys = map[string][]byte{"hs-1": secret}
+			j, err := NewJWT(tc.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			j.now = func() time.Time { return testNow }
+
+			if _, err := j.Verify(tc.token); !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadRSAPublicKeyFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tcs := []struct {
+		name  string
+		block *pem.Block
+	}{
+		{name: "PKIX", block: &pem.Block{Type: "PUBLIC KEY", Bytes: pkix}},
+		{name: "PKCS1", block: &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(tempDir(t), "key.pem")
+			if err := ioutil.WriteFile(path, pem.EncodeToMemory(tc.block), 0600); err != nil {
+				t.Fatalf("could not write key: %v", err)
+			}
+
+			got, err := LoadRSAPublicKeyFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.N.Cmp(key.N) != 0 || got.E != key.E {
+				t.Error("want the loaded key to match the generated one")
+			}
+		})
+	}
+}
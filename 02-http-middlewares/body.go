@@ -0,0 +1,367 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// DefaultMaxBodyBytes is the request body size limit when none is configured, 1MB.
+const DefaultMaxBodyBytes = 1 << 20
+
+var (
+	// ErrBodyTooLarge is returned when the request body is larger than allowed.
+	// It's answered with 413 Request Entity Too Large.
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrUnsupportedContentType is returned, usually wrapped, when the request body content type
+	// is not accepted. It's answered with 415 Unsupported Media Type.
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	// ErrInvalidJSON is returned, usually wrapped, when the request body is not valid JSON for
+	// the value it's decoded into. It's answered with 400 Bad Request.
+	ErrInvalidJSON = errors.New("invalid JSON")
+)
+
+// BodyLimitConfig configures BodyLimit.
+type BodyLimitConfig struct {
+	// MaxBytes is the maximum request body size, defaults to DefaultMaxBodyBytes.
+	MaxBytes int64
+	// ContentTypes are the media types accepted for request bodies, e.g. "application/json".
+	// Defaults to JSON: application/json and any "+json" type, e.g. application/merge-patch+json.
+	ContentTypes []string
+}
+
+// BodyLimit returns a middleware which rejects request bodies larger than cfg.MaxBytes with
+// 413 Request Entity Too Large and the ones with a content type not in cfg.ContentTypes with
+// 415 Unsupported Media Type. Bodies without a Content-Length are cut at cfg.MaxBytes, reading
+// beyond returns ErrBodyTooLarge, which DecodeJSON and WriteBodyError turn into a 413.
+func BodyLimit(cfg BodyLimitConfig) func(next http.Handler) http.Handler {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBodyBytes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := checkContentType(r, cfg.ContentTypes); err != nil {
+				WriteBodyError(w, r, err)
+				return
+			}
+			if r.ContentLength > cfg.MaxBytes {
+				WriteBodyError(w, r, fmt.Errorf("%w: %d bytes, the limit is %d", ErrBodyTooLarge, r.ContentLength, cfg.MaxBytes))
+				return
+			}
+
+			r.Body = &limitedBody{ReadCloser: r.Body, left: cfg.MaxBytes}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody is like http.MaxBytesReader but returns ErrBodyTooLarge, so it can be told apart
+// from other read errors.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.left {
+		b.left -= int64(n)
+		return n, err
+	}
+
+	n = int(b.left)
+	b.left = -1
+	return n, ErrBodyTooLarge
+}
+
+// DecodeJSON decodes the JSON request body into v and validates it with Validate. The body must
+// have a JSON content type, be at most DefaultMaxBodyBytes, or the BodyLimit limit, and hold a
+// single JSON value without fields v does not have. Of the values of the wrong type, only the
+// first one is reported, as encoding/json does.
+// The errors can be answered with WriteBodyError:
+//
+//	var req CreateUserRequest
+//	if err := middlewares.DecodeJSON(r, &req); err != nil {
+//		middlewares.WriteBodyError(w, r, err)
+//		return
+//	}
+func DecodeJSON(r *http.Request, v interface{}) error {
+	if err := checkContentType(r, nil); err != nil {
+		return err
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	if _, ok := body.(*limitedBody); !ok {
+		body = &limitedBody{ReadCloser: body, left: DefaultMaxBodyBytes}
+	}
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err, reflect.TypeOf(v))
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return err
+		}
+		return fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidJSON)
+	}
+
+	return Validate(v)
+}
+
+// decodeError turns the error decoding into a value of type t into ErrInvalidJSON, or a
+// ValidationErrors for a value of the wrong type.
+func decodeError(err error, t reflect.Type) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return err
+	case err == io.EOF:
+		return fmt.Errorf("%w: the request body is empty", ErrInvalidJSON)
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: unexpected end of the request body", ErrInvalidJSON)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w: %s at offset %d", ErrInvalidJSON, syntaxErr, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return ValidationErrors{{
+			Path:    typeErrorPath(t, typeErr),
+			Message: fmt.Sprintf("must be %s, got %s", jsonKind(typeErr.Type), typeErr.Value),
+		}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, strings.TrimPrefix(err.Error(), "json: "))
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+	}
+}
+
+// typeErrorPath returns the JSON pointer to the value of err, decoded into a value of type t.
+// encoding/json joins the object keys and array indexes with ".", so to tell apart the keys
+// with a "." the path is split where it leads to a value of err.Type.
+func typeErrorPath(t reflect.Type, err *json.UnmarshalTypeError) string {
+	if err.Field == "" {
+		return ""
+	}
+
+	segments, ok := splitFieldPath(t, err.Field, err.Type)
+	if !ok {
+		segments = strings.Split(err.Field, ".")
+	}
+
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		if fieldPathEscaped {
+			b.WriteString(s)
+		} else {
+			b.WriteString(escapePointer(s))
+		}
+	}
+	return b.String()
+}
+
+// fieldPathEscaped tells whether encoding/json escapes the keys on json.UnmarshalTypeError.Field
+// as JSON pointer reference tokens, as it does when backed by encoding/json/v2.
+var fieldPathEscaped = func() bool {
+	var m map[string]int
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(json.Unmarshal([]byte(`{"/":""}`), &m), &typeErr) && typeErr.Field == "~1"
+}()
+
+// splitFieldPath splits field, the "." joined path to a value of type want in a value of
+// type t, into its object keys and array indexes. It reports whether there is such a path.
+func splitFieldPath(t reflect.Type, field string, want reflect.Type) ([]string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if field == "" {
+		for want.Kind() == reflect.Ptr {
+			want = want.Elem()
+		}
+		return nil, t == want
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+
+			switch {
+			case f.Anonymous && name == "" && isStruct(f.Type):
+				// the fields of embedded structs are promoted, some encoding/json versions
+				// still have the embedded struct on the path
+				if segments, ok := splitFieldPath(f.Type, field, want); ok {
+					return segments, true
+				}
+				if rest := strings.TrimPrefix(field, f.Name+"."); rest != field {
+					if segments, ok := splitFieldPath(f.Type, rest, want); ok {
+						return segments, true
+					}
+				}
+				continue
+			case f.PkgPath != "":
+				continue
+			case name == "":
+				name = f.Name
+			}
+			if fieldPathEscaped {
+				name = escapePointer(name)
+			}
+
+			if segments, ok := splitKey(field, name, f.Type, want); ok {
+				return segments, true
+			}
+		}
+	case reflect.Map:
+		// the key can have dots, try the longest first
+		for i := len(field); i > 0; i = strings.LastIndexByte(field[:i], '.') {
+			if segments, ok := splitKey(field, field[:i], t.Elem(), want); ok {
+				return segments, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		i := strings.IndexByte(field, '.')
+		if i < 0 {
+			i = len(field)
+		}
+		if _, err := strconv.Atoi(field[:i]); err == nil {
+			return splitKey(field, field[:i], t.Elem(), want)
+		}
+	}
+
+	return nil, false
+}
+
+// splitKey splits field into key and the path after it, to a value of type want in a value
+// of type t, see splitFieldPath.
+func splitKey(field, key string, t, want reflect.Type) ([]string, bool) {
+	var rest string
+	switch {
+	case field == key:
+	case strings.HasPrefix(field, key+"."):
+		rest = field[len(key)+1:]
+	default:
+		return nil, false
+	}
+
+	segments, ok := splitFieldPath(t, rest, want)
+	if !ok {
+		return nil, false
+	}
+	return append([]string{key}, segments...), true
+}
+
+// jsonKind describes the JSON values t can be decoded from.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	default:
+		return "a " + t.String()
+	}
+}
+
+// checkContentType returns ErrUnsupportedContentType unless r has one of the media types
+// allowed, or a JSON one if allowed is empty.
+func checkContentType(r *http.Request, allowed []string) error {
+	ct := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedContentType, ct)
+	}
+
+	if len(allowed) == 0 {
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return nil
+		}
+		return fmt.Errorf("%w: %q, want application/json", ErrUnsupportedContentType, ct)
+	}
+
+	for _, a := range allowed {
+		if strings.EqualFold(mediaType, a) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q, want one of %s", ErrUnsupportedContentType, ct, strings.Join(allowed, ", "))
+}
+
+// ValidationErrorBody is the JSON body of 422 Unprocessable Entity responses, it lists all the
+// invalid fields.
+type ValidationErrorBody struct {
+	tracking.ErrorBody
+	Errors ValidationErrors `json:"errors"`
+}
+
+// WriteBodyError replies to r with a JSON error for err, returned by DecodeJSON or read from a
+// body limited by BodyLimit:
+// 413 for ErrBodyTooLarge, 415 for ErrUnsupportedContentType, 400 for ErrInvalidJSON,
+// 422 with every invalid field for ValidationErrors and 500 for anything else.
+func WriteBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs ValidationErrors
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		// Do not keep reading the rest of the body to reuse the connection.
+		w.Header().Set("Connection", "close")
+		tracking.WriteJSONError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, ErrUnsupportedContentType):
+		tracking.WriteJSONError(w, r, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, ErrInvalidJSON):
+		tracking.WriteJSONError(w, r, http.StatusBadRequest, err.Error())
+	case errors.As(err, &validationErrs):
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(ValidationErrorBody{
+			ErrorBody: tracking.NewErrorBody(r.Context(), fmt.Sprintf("invalid request body: %d invalid field(s)", len(validationErrs))),
+			Errors:    validationErrs,
+		})
+	default:
+		tracking.WriteJSONError(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,246 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+type testOrder struct {
+	Item     string `json:"item" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1,max=10"`
+	Status   string `json:"status" validate:"enum=open|closed"`
+}
+
+func TestBodyLimit(t *testing.T) {
+	var read string
+	var readErr error
+	h := BodyLimit(BodyLimitConfig{MaxBytes: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		read, readErr = string(b), err
+	}))
+
+	tcs := []struct {
+		name          string
+		body          io.Reader
+		contentLength int64
+		contentType   string
+		wantStatus    int
+		wantRead      string
+		wantErr       error
+	}{
+		{name: "no body", wantStatus: http.StatusOK},
+		{name: "within the limit", body: strings.NewReader(`{"a":1}`), contentType: "application/json", wantStatus: http.StatusOK, wantRead: `{"a":1}`},
+		{name: "json suffix", body: strings.NewReader(`{}`), contentType: "application/merge-patch+json", wantStatus: http.StatusOK, wantRead: `{}`},
+		{name: "content length too large", body: strings.NewReader(`{"a":100}`), contentType: "application/json", wantStatus: http.StatusRequestEntityTooLarge},
+		{
+			name:          "unknown length too large",
+			body:          strings.NewReader(`{"a":100}`),
+			contentLength: -1,
+			contentType:   "application/json",
+			wantStatus:    http.StatusOK,
+			wantRead:      `{"a":100`,
+			wantErr:       ErrBodyTooLarge,
+		},
+		{name: "not JSON", body: strings.NewReader(`a=1`), contentType: "application/x-www-form-urlencoded", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "no content type", body: strings.NewReader(`{}`), wantStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			read, readErr = "", nil
+
+			r := httptest.NewRequest(http.MethodPost, "/", tc.body)
+			if tc.contentLength != 0 {
+				r.ContentLength = tc.contentLength
+			}
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if read != tc.wantRead {
+				t.Errorf("want read: %q, got: %q", tc.wantRead, read)
+			}
+			if !errors.Is(readErr, tc.wantErr) {
+				t.Errorf("want read error: %v, got: %v", tc.wantErr, readErr)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tcs := []struct {
+		name        string
+		body        string
+		contentType string
+		want        testOrder
+		wantErr     error
+	}{
+		{
+			name:        "valid",
+			body:        `{"item":"gopher plush","quantity":2,"status":"open"}`,
+			contentType: "application/json; charset=utf-8",
+			want:        testOrder{Item: "gopher plush", Quantity: 2, Status: "open"},
+		},
+		{name: "not JSON", body: `{"item":"x"}`, contentType: "text/plain", wantErr: ErrUnsupportedContentType},
+		{name: "empty", contentType: "application/json", wantErr: ErrInvalidJSON},
+		{name: "malformed", body: `{"item":`, contentType: "application/json", wantErr: ErrInvalidJSON},
+		{name: "syntax error", body: `{"item" "x"}`, contentType: "application/json", wantErr: ErrInvalidJSON},
+		{name: "unknown field", body: `{"item":"x","price":1}`, contentType: "application/json", wantErr: ErrInvalidJSON},
+		{name: "trailing data", body: `{"item":"x"} {"item":"y"}`, contentType: "application/json", wantErr: ErrInvalidJSON},
+		{name: "too large", body: `{"item":"` + strings.Repeat("x", DefaultMaxBodyBytes) + `"}`, contentType: "application/json", wantErr: ErrBodyTooLarge},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+
+			var got testOrder
+			err := DecodeJSON(r, &got)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want error: %v, got: %v", tc.wantErr, err)
+			}
+			if err == nil && got != tc.want {
+				t.Errorf("want: %+v, got: %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONValidationErrors(t *testing.T) {
+	tcs := []struct {
+		name string
+		body string
+		want ValidationErrors
+	}{
+		{
+			name: "all the invalid fields",
+			body: `{"quantity":11,"status":"pending"}`,
+			want: ValidationErrors{
+				{Path: "/item", Message: "is required"},
+				{Path: "/quantity", Message: "must be at most 10"},
+				{Path: "/status", Message: "must be one of open, closed"},
+			},
+		},
+		{
+			name: "wrong type",
+			body: `{"item":"x","quantity":"two"}`,
+			want: ValidationErrors{{Path: "/quantity", Message: "must be an integer, got string"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", "application/json")
+			r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+
+			var order testOrder
+			err := DecodeJSON(r, &order)
+
+			w := httptest.NewRecorder()
+			WriteBodyError(w, r, err)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("want status: %d, got: %d", http.StatusUnprocessableEntity, w.Code)
+			}
+			var body ValidationErrorBody
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("could not decode the response body: %v", err)
+			}
+			if body.TrackingID != "some-id" {
+				t.Errorf("want tracking_id: some-id, got: %q", body.TrackingID)
+			}
+			if !reflect.DeepEqual(body.Errors, tc.want) {
+				t.Errorf("want: %v, got: %v", tc.want, body.Errors)
+			}
+		})
+	}
+}
+
+func TestWriteBodyError(t *testing.T) {
+	tcs := []struct {
+		err  error
+		want int
+	}{
+		{err: ErrBodyTooLarge, want: http.StatusRequestEntityTooLarge},
+		{err: ErrUnsupportedContentType, want: http.StatusUnsupportedMediaType},
+		{err: ErrInvalidJSON, want: http.StatusBadRequest},
+		{err: errors.New("boom"), want: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tcs {
+		w := httptest.NewRecorder()
+		WriteBodyError(w, httptest.NewRequest(http.MethodPost, "/", nil), tc.err)
+
+		if w.Code != tc.want {
+			t.Errorf("%v: want status: %d, got: %d", tc.err, tc.want, w.Code)
+		}
+	}
+}
+
+func TestTypeErrorPath(t *testing.T) {
+	type item struct {
+		N int `json:"n"`
+	}
+	type Embedded struct {
+		E int `json:"e"`
+	}
+	type doc struct {
+		Embedded
+		Items  []item            `json:"items"`
+		ByName map[string]item   `json:"by_name"`
+		Counts map[string]*int   `json:"counts"`
+		Nested map[string][]item `json:"nested"`
+		Dotted int               `json:"a.b"`
+	}
+
+	tcs := []struct {
+		body string
+		want string
+		// keys is set when the path has map keys or slice indexes, which only
+		// the encoding/json/v2 backed decoder reports.
+		keys bool
+	}{
+		{body: `{"items":[{"n":1},{"n":"x"}]}`, want: "/items/1/n", keys: true},
+		{body: `{"by_name":{"k.x":{"n":"x"}}}`, want: "/by_name/k.x/n", keys: true},
+		{body: `{"by_name":{"k":"x"}}`, want: "/by_name/k", keys: true},
+		{body: `{"counts":{"a.b[0]":"x"}}`, want: "/counts/a.b[0]", keys: true},
+		{body: `{"counts":{"a/b~":"x"}}`, want: "/counts/a~1b~0", keys: true},
+		{body: `{"nested":{"k.0":[{"n":"x"}]}}`, want: "/nested/k.0/0/n", keys: true},
+		{body: `{"a.b":"x"}`, want: "/a.b"},
+		{body: `{"e":"x"}`, want: "/e"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.body, func(t *testing.T) {
+			if tc.keys && !fieldPathEscaped {
+				t.Skip("encoding/json does not report map keys nor slice indexes")
+			}
+
+			var d doc
+			var typeErr *json.UnmarshalTypeError
+			if err := json.Unmarshal([]byte(tc.body), &d); !errors.As(err, &typeErr) {
+				t.Fatalf("want a *json.UnmarshalTypeError, got: %v", err)
+			}
+
+			if got := typeErrorPath(reflect.TypeOf(&d), typeErr); got != tc.want {
+				t.Errorf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPanicked is returned to the callers waiting on a call which panicked.
+var ErrPanicked = errors.New("cache: the call panicked")
+
+// Group collapses concurrent calls for the same key into one. The zero value is ready to use.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Do calls fn and returns its results, unless there is a call for key in flight already, then
+// it waits for it and returns its results. shared reports whether the results come from
+// another call. If fn panics the panic goes on, and the callers waiting get ErrPanicked.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &call{err: ErrPanicked}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupDo(t *testing.T) {
+	var g Group
+	var calls, shared int32
+	started, release := make(chan struct{}), make(chan struct{})
+
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "v", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	do := func() {
+		defer wg.Done()
+		v, err, s := g.Do("k", fn)
+		if v != "v" || err != nil {
+			t.Errorf("want: v, got: %v, %v", v, err)
+		}
+		if s {
+			atomic.AddInt32(&shared, 1)
+		}
+	}
+
+	wg.Add(n)
+	go do()
+	<-started
+	for i := 1; i < n; i++ {
+		go do()
+	}
+	// let the others wait on the first call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || shared != n-1 {
+		t.Errorf("want 1 call shared by %d, got %d calls shared by %d", n-1, calls, shared)
+	}
+
+	if v, _, s := g.Do("k", func() (interface{}, error) { return "again", nil }); v != "again" || s {
+		t.Errorf("want a new call once the first is done, got: %v, shared: %t", v, s)
+	}
+}
+
+func TestGroupDoPanic(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan interface{})
+
+	go func() {
+		defer func() { panicked <- recover() }()
+		_, _, _ = g.Do("k", func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	errs := make(chan error)
+	go func() {
+		_, err, _ := g.Do("k", func() (interface{}, error) { return nil, nil })
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if v := <-panicked; v != "boom" {
+		t.Errorf("want the panic to go on, got: %v", v)
+	}
+	if err := <-errs; !errors.Is(err, ErrPanicked) {
+		t.Errorf("want: %v, got: %v", ErrPanicked, err)
+	}
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// LRU is a least recently used cache bounded by the total size of its values, as given when
+// they are added. It's safe for concurrent use.
+type LRU struct {
+	maxBytes int64
+
+	mu        sync.Mutex
+	bytes     int64
+	ll        *list.List
+	items     map[string]*list.Element
+	evictions uint64
+}
+
+type entry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+// NewLRU returns an empty LRU holding up to maxBytes. It panics if maxBytes is not positive.
+func NewLRU(maxBytes int64) *LRU {
+	if maxBytes <= 0 {
+		panic(fmt.Sprintf("cache: maxBytes must be positive, got %d", maxBytes))
+	}
+
+	return &LRU{maxBytes: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the value of key, if any, and marks it as the most recently used.
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*entry).value, true
+}
+
+// Add sets the value of key, of size bytes, evicting the least recently used values until it
+// fits. It returns false, and adds nothing, if size is larger than the whole cache.
+func (c *LRU) Add(key string, value interface{}, size int64) bool {
+	if size > c.maxBytes {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		c.bytes += size - e.size
+		e.value, e.size = value, size
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key: key, value: value, size: size})
+		c.bytes += size
+	}
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+	return true
+}
+
+// Remove removes key, if present.
+func (c *LRU) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *LRU) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// Len returns the number of values in the cache.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of the values in the cache.
+func (c *LRU) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.bytes
+}
+
+// Evictions returns how many values were evicted to make room for others.
+func (c *LRU) Evictions() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evictions
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func keys(c *LRU) []string {
+	var ks []string
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		ks = append(ks, el.Value.(*entry).key)
+	}
+	return ks
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(10)
+
+	c.Add("a", 1, 4)
+	c.Add("b", 2, 4)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("want a cached")
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(keys(c), want) {
+		t.Fatalf("want order: %v, got: %v", want, keys(c))
+	}
+
+	// b is the least recently used
+	c.Add("c", 3, 4)
+	if _, ok := c.Get("b"); ok {
+		t.Error("want b evicted")
+	}
+	if got := c.Bytes(); got != 8 {
+		t.Errorf("want 8 bytes, got: %d", got)
+	}
+	if got := c.Evictions(); got != 1 {
+		t.Errorf("want 1 eviction, got: %d", got)
+	}
+
+	// growing a evicts c
+	c.Add("a", 10, 7)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("want a updated to 10, got: %v", v)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(keys(c), want) {
+		t.Errorf("want: %v, got: %v", want, keys(c))
+	}
+
+	if c.Add("huge", 0, 11) {
+		t.Error("want values larger than the cache rejected")
+	}
+	if c.Len() != 1 {
+		t.Errorf("want a kept, got %d values", c.Len())
+	}
+
+	c.Remove("a")
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Errorf("want empty after removing a, got %d values of %d bytes", c.Len(), c.Bytes())
+	}
+}
+
+func TestNewLRUPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic, got none")
+		}
+	}()
+
+	NewLRU(0)
+}
@@ -0,0 +1,218 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a http.Handler adding some behaviour to it.
+type Middleware func(next http.Handler) http.Handler
+
+// unnamed is how middlewares added without a name are listed by Chain.Names.
+const unnamed = "<unnamed>"
+
+// ErrMiddlewareNotFound is returned when inserting relative to a name not on the chain.
+var ErrMiddlewareNotFound = errors.New("middleware not found")
+
+type namedMiddleware struct {
+	name string
+	mw   Middleware
+}
+
+// Chain is an immutable list of middlewares. They are applied in the order they are added,
+// the first one being the outermost, the first to see the request:
+//
+//	NewChain(solution.TrackingID, Recover(logger)).Then(h)
+//
+// is the same as solution.TrackingID(Recover(logger)(h)), so the panics are logged with the
+// tracking id.
+//
+// All methods return a new Chain, so a Chain can safely be shared and extended.
+type Chain struct {
+	mws []namedMiddleware
+}
+
+// NewChain returns a Chain with mws.
+func NewChain(mws ...Middleware) Chain {
+	return Chain{}.Append(mws...)
+}
+
+// Append returns a new Chain with mws added to the end of c.
+func (c Chain) Append(mws ...Middleware) Chain {
+	n := c.clone(len(mws))
+	for _, mw := range mws {
+		n.mws = append(n.mws, namedMiddleware{mw: mw})
+	}
+	return n
+}
+
+// AppendNamed returns a new Chain with mw added to the end of c as name.
+// The name is used to list the chain, see Names, and to insert relative to it.
+func (c Chain) AppendNamed(name string, mw Middleware) Chain {
+	n := c.clone(1)
+	n.mws = append(n.mws, namedMiddleware{name: name, mw: mw})
+	return n
+}
+
+// Extend returns a new Chain with the middlewares of other added to the end of c.
+func (c Chain) Extend(other Chain) Chain {
+	n := c.clone(len(other.mws))
+	n.mws = append(n.mws, other.mws...)
+	return n
+}
+
+// InsertBefore returns a new Chain with mw added as name right before the first middleware
+// called before. It returns ErrMiddlewareNotFound if there is none.
+func (c Chain) InsertBefore(before, name string, mw Middleware) (Chain, error) {
+	return c.insert(before, 0, name, mw)
+}
+
+// InsertAfter returns a new Chain with mw added as name right after the first middleware
+// called after. It returns ErrMiddlewareNotFound if there is none.
+func (c Chain) InsertAfter(after, name string, mw Middleware) (Chain, error) {
+	return c.insert(after, 1, name, mw)
+}
+
+func (c Chain) insert(target string, offset int, name string, mw Middleware) (Chain, error) {
+	for i, m := range c.mws {
+		if m.name != target || target == "" {
+			continue
+		}
+
+		i += offset
+		n := Chain{mws: make([]namedMiddleware, 0, len(c.mws)+1)}
+		n.mws = append(n.mws, c.mws[:i]...)
+		n.mws = append(n.mws, namedMiddleware{name: name, mw: mw})
+		n.mws = append(n.mws, c.mws[i:]...)
+		return n, nil
+	}
+
+	return c, fmt.Errorf("could not insert %q: %w: %q", name, ErrMiddlewareNotFound, target)
+}
+
+// Len returns the number of middlewares on c.
+func (c Chain) Len() int {
+	return len(c.mws)
+}
+
+// Names returns the names of the middlewares on c, in the order they are applied.
+// Middlewares added without a name are listed as "<unnamed>".
+func (c Chain) Names() []string {
+	names := make([]string, len(c.mws))
+	for i, m := range c.mws {
+		names[i] = m.name
+		if names[i] == "" {
+			names[i] = unnamed
+		}
+	}
+	return names
+}
+
+// String returns the names of the middlewares on c, e.g. "recover -> tracking_id -> log".
+func (c Chain) String() string {
+	return strings.Join(c.Names(), " -> ")
+}
+
+// Then returns h wrapped by all middlewares on c. A nil h means http.DefaultServeMux.
+func (c Chain) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		h = c.mws[i].mw(h)
+	}
+	return h
+}
+
+// ThenFunc is Then for a http.HandlerFunc. A nil fn means http.DefaultServeMux.
+func (c Chain) ThenFunc(fn http.HandlerFunc) http.Handler {
+	if fn == nil {
+		return c.Then(nil)
+	}
+	return c.Then(fn)
+}
+
+// clone returns a copy of c with room for extra more middlewares, so appending
+// to it never changes c.
+func (c Chain) clone(extra int) Chain {
+	mws := make([]namedMiddleware, len(c.mws), len(c.mws)+extra)
+	copy(mws, c.mws)
+	return Chain{mws: mws}
+}
+
+// Route is a pattern registered through a Group and its middlewares.
+type Route struct {
+	Pattern     string
+	Middlewares []string
+}
+
+// Group registers handlers on a http.ServeMux wrapped by a Chain, so different route
+// subsets can have different middlewares:
+//
+//	root := NewGroup(mux, NewChain(solution.TrackingID, Recover(logger)))
+//	api := root.Group("/api", NewChain(Timeout(5*time.Second)))
+//	api.HandleFunc("/users", users) // registers /api/users with TrackingID, Recover and Timeout
+type Group struct {
+	mux    *http.ServeMux
+	prefix string
+	chain  Chain
+
+	// routes is shared by all groups derived from the same root
+	routes *routes
+}
+
+type routes struct {
+	mu   sync.Mutex
+	list []Route
+}
+
+// NewGroup returns a Group registering handlers on mux wrapped by c.
+func NewGroup(mux *http.ServeMux, c Chain) *Group {
+	return &Group{mux: mux, chain: c, routes: &routes{}}
+}
+
+// Group returns a sub-group whose patterns are prefixed by prefix and whose handlers are
+// wrapped by the chain of g followed by c.
+func (g *Group) Group(prefix string, c Chain) *Group {
+	return &Group{
+		mux:    g.mux,
+		prefix: g.prefix + prefix,
+		chain:  g.chain.Extend(c),
+		routes: g.routes,
+	}
+}
+
+// Chain returns the chain applied to the handlers registered on g.
+func (g *Group) Chain() Chain {
+	return g.chain
+}
+
+// Handle registers h, wrapped by the group chain, for the group prefix followed by pattern.
+func (g *Group) Handle(pattern string, h http.Handler) {
+	pattern = g.prefix + pattern
+	g.mux.Handle(pattern, g.chain.Then(h))
+
+	g.routes.mu.Lock()
+	defer g.routes.mu.Unlock()
+	g.routes.list = append(g.routes.list, Route{Pattern: pattern, Middlewares: g.chain.Names()})
+}
+
+// HandleFunc is Handle for a http.HandlerFunc.
+func (g *Group) HandleFunc(pattern string, fn http.HandlerFunc) {
+	g.Handle(pattern, fn)
+}
+
+// Routes returns every route registered through g, the groups it was derived from and
+// their sub-groups, in the order they were registered.
+func (g *Group) Routes() []Route {
+	g.routes.mu.Lock()
+	defer g.routes.mu.Unlock()
+
+	routes := make([]Route, len(g.routes.list))
+	copy(routes, g.routes.list)
+	return routes
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tag returns a middleware appending name to the X-Order response header.
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func order(t *testing.T, h http.Handler, target string) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return strings.Join(w.Header()["X-Order"], ",")
+}
+
+var noop = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestChain(t *testing.T) {
+	base := NewChain(tag("a")).AppendNamed("b", tag("b"))
+
+	tcs := []struct {
+		name      string
+		chain     Chain
+		wantOrder string
+		wantNames []string
+	}{
+		{name: "empty", chain: Chain{}, wantOrder: "", wantNames: []string{}},
+		{name: "base", chain: base, wantOrder: "a,b", wantNames: []string{unnamed, "b"}},
+		{name: "append", chain: base.Append(tag("c")), wantOrder: "a,b,c", wantNames: []string{unnamed, "b", unnamed}},
+		{
+			name:      "extend",
+			chain:     base.Extend(NewChain().AppendNamed("c", tag("c")).AppendNamed("d", tag("d"))),
+			wantOrder: "a,b,c,d",
+			wantNames: []string{unnamed, "b", "c", "d"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := order(t, tc.chain.Then(noop), "/"); got != tc.wantOrder {
+				t.Errorf("want order: %q, got: %q", tc.wantOrder, got)
+			}
+			if got := tc.chain.Names(); !reflect.DeepEqual(got, tc.wantNames) {
+				t.Errorf("want names: %v, got: %v", tc.wantNames, got)
+			}
+		})
+	}
+
+	// derived chains must not change the one they came from
+	if got := order(t, base.ThenFunc(noop), "/"); got != "a,b" {
+		t.Errorf("want base chain unchanged: a,b, got: %q", got)
+	}
+}
+
+func TestChainAppendDoesNotShareBackingArray(t *testing.T) {
+	base := NewChain(tag("a"), tag("b"))
+	c1 := base.Append(tag("c"))
+	c2 := base.Append(tag("d"))
+
+	if got := order(t, c1.Then(noop), "/"); got != "a,b,c" {
+		t.Errorf("want: a,b,c, got: %q", got)
+	}
+	if got := order(t, c2.Then(noop), "/"); got != "a,b,d" {
+		t.Errorf("want: a,b,d, got: %q", got)
+	}
+}
+
+func TestChainInsert(t *testing.T) {
+	base := NewChain().
+		AppendNamed("recover", tag("recover")).
+		AppendNamed("log", tag("log"))
+
+	before, err := base.InsertBefore("log", "tracking_id", tag("tracking_id"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := before.String(), "recover -> tracking_id -> log"; got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	after, err := base.InsertAfter("log", "timeout", tag("timeout"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := order(t, after.Then(noop), "/"), "recover,log,timeout"; got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	if _, err := base.InsertAfter("missing", "x", tag("x")); !errors.Is(err, ErrMiddlewareNotFound) {
+		t.Errorf("want: %v, got: %v", ErrMiddlewareNotFound, err)
+	}
+	if got, want := base.String(), "recover -> log"; got != want {
+		t.Errorf("want base chain unchanged: %s, got: %s", want, got)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	mux := http.NewServeMux()
+	root := NewGroup(mux, NewChain().AppendNamed("root", tag("root")))
+	api := root.Group("/api", NewChain().AppendNamed("api", tag("api")))
+	admin := api.Group("/admin", NewChain().AppendNamed("admin", tag("admin")))
+
+	root.HandleFunc("/health", noop)
+	api.HandleFunc("/users", noop)
+	admin.Handle("/stats", noop)
+
+	tcs := []struct {
+		target    string
+		wantOrder string
+	}{
+		{target: "/health", wantOrder: "root"},
+		{target: "/api/users", wantOrder: "root,api"},
+		{target: "/api/admin/stats", wantOrder: "root,api,admin"},
+	}
+	for _, tc := range tcs {
+		if got := order(t, mux, tc.target); got != tc.wantOrder {
+			t.Errorf("%s: want order: %q, got: %q", tc.target, tc.wantOrder, got)
+		}
+	}
+
+	want := []Route{
+		{Pattern: "/health", Middlewares: []string{"root"}},
+		{Pattern: "/api/users", Middlewares: []string{"root", "api"}},
+		{Pattern: "/api/admin/stats", Middlewares: []string{"root", "api", "admin"}},
+	}
+	if got := api.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,347 @@
+package middlewares
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressContentTypes are the content types compressed by default.
+var DefaultCompressContentTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/*",
+}
+
+// CompressConfig configures the middleware returned by Compress.
+type CompressConfig struct {
+	// Level is the compression level, from zlib.BestSpeed to zlib.BestCompression.
+	// Defaults to zlib.DefaultCompression.
+	Level int
+	// MinSize is the minimum response size, in bytes, worth compressing. Defaults to 1024.
+	MinSize int
+	// ContentTypes are the media types compressed, "type/*" matches any subtype.
+	// Defaults to DefaultCompressContentTypes.
+	ContentTypes []string
+}
+
+// Compress returns a middleware which compresses the responses with gzip or deflate, as
+// negotiated with the client Accept-Encoding header. Only responses of cfg.ContentTypes, with
+// at least cfg.MinSize bytes, and not encoded already are compressed. The response is buffered
+// until cfg.MinSize bytes are written, the handler finishes or it flushes, whatever comes first.
+// Flushing decides by the content type alone, so streams are compressed as they flush.
+func Compress(cfg CompressConfig) func(next http.Handler) http.Handler {
+	if cfg.Level == 0 || cfg.Level < zlib.HuffmanOnly || cfg.Level > zlib.BestCompression {
+		cfg.Level = zlib.DefaultCompression
+	}
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = 1024
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = DefaultCompressContentTypes
+	}
+
+	c := &compressor{minSize: cfg.MinSize, types: map[string]bool{}}
+	for _, t := range cfg.ContentTypes {
+		c.types[strings.ToLower(t)] = true
+	}
+	c.gzipPool.New = func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, cfg.Level)
+		return gz
+	}
+	c.zlibPool.New = func() interface{} {
+		// deflate is the zlib format (RFC 1950), not a raw deflate stream
+		zl, _ := zlib.NewWriterLevel(nil, cfg.Level)
+		return zl
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, c: c, encoding: encoding}
+			defer cw.close()
+
+			next.ServeHTTP(wrapOptionalInterfaces(w, cw), r)
+		})
+	}
+}
+
+type compressor struct {
+	minSize  int
+	types    map[string]bool
+	gzipPool sync.Pool
+	zlibPool sync.Pool
+}
+
+// compressible reports whether the media type of contentType is to be compressed.
+func (c *compressor) compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if c.types[mt] {
+		return true
+	}
+	if i := strings.IndexByte(mt, '/'); i > 0 {
+		return c.types[mt[:i]+"/*"]
+	}
+	return false
+}
+
+// compressWriter buffers the response until it can decide whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	// cw is the compressing writer, nil if the response is not compressed
+	cw interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+
+	// informational responses go straight through
+	if statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	w.status = statusCode
+	w.wroteHeader = true
+
+	h := w.Header()
+	switch {
+	case statusCode == http.StatusNoContent,
+		statusCode == http.StatusNotModified,
+		statusCode == http.StatusPartialContent,
+		statusCode == http.StatusSwitchingProtocols:
+		w.decide(false)
+	case h.Get("Content-Length") != "":
+		n, err := strconv.Atoi(h.Get("Content-Length"))
+		if err != nil || n < w.c.minSize {
+			w.decide(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.decided {
+		if w.cw != nil {
+			return w.cw.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.c.minSize {
+		if err := w.decideAndFlushBuffer(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		_ = w.decideAndFlushBuffer(true)
+	}
+	if w.cw != nil {
+		_ = w.cw.Flush()
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom copies src through Write, the underlying io.ReaderFrom would skip the compression.
+func (w *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, it's used by http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decideAndFlushBuffer decides whether to compress, allowing it only if sizeOK, and writes
+// the buffered bytes.
+func (w *compressWriter) decideAndFlushBuffer(sizeOK bool) error {
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		// as net/http would, so the content type is known
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	w.decide(sizeOK && h.Get("Content-Encoding") == "" && w.c.compressible(h.Get("Content-Type")))
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.cw != nil {
+		_, err := w.cw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// decide sets whether the response is compressed and writes the header.
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// the compressed response is not byte for byte the same
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch w.encoding {
+		case "gzip":
+			gz := w.c.gzipPool.Get().(*gzip.Writer)
+			gz.Reset(w.ResponseWriter)
+			w.cw = gz
+		case "deflate":
+			zl := w.c.zlibPool.Get().(*zlib.Writer)
+			zl.Reset(w.ResponseWriter)
+			w.cw = zl
+		}
+	}
+
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// close writes what's left of the response and returns the compressing writer to its pool.
+func (w *compressWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			// the handler wrote nothing, leave it to net/http
+			return
+		}
+		_ = w.decideAndFlushBuffer(false)
+	}
+
+	if w.cw == nil {
+		return
+	}
+
+	_ = w.cw.Close()
+	switch cw := w.cw.(type) {
+	case *gzip.Writer:
+		cw.Reset(nil)
+		w.c.gzipPool.Put(cw)
+	case *zlib.Writer:
+		cw.Reset(nil)
+		w.c.zlibPool.Put(cw)
+	}
+	w.cw = nil
+}
+
+// negotiateEncoding returns the encoding to use, "gzip" or "deflate", for the Accept-Encoding
+// header acceptEncoding, or "" if the client accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	var (
+		best  string
+		bestQ float64
+		anyQ  = -1.0
+	)
+	qs := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseQuality(part)
+		switch coding {
+		case "":
+			continue
+		case "*":
+			anyQ = q
+		default:
+			qs[coding] = q
+		}
+	}
+
+	for _, enc := range []string{"gzip", "deflate"} {
+		q, ok := qs[enc]
+		if !ok {
+			if anyQ < 0 {
+				continue
+			}
+			q = anyQ
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// parseQuality parses an element of an Accept-* header, e.g. "gzip;q=0.8", into its
+// lower case value and quality. The quality defaults to 1, invalid ones are 0.
+func parseQuality(s string) (string, float64) {
+	value, params := s, ""
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		value, params = s[:i], s[i+1:]
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	q := 1.0
+	for _, p := range strings.Split(params, ";") {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") && !strings.HasPrefix(p, "Q=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil || v < 0 || v > 1 {
+			v = 0
+		}
+		q = v
+	}
+
+	return value, q
+}
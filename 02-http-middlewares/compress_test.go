@@ -0,0 +1,267 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tcs := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "deflate", want: "deflate"},
+		{acceptEncoding: "gzip, deflate, br", want: "gzip"},
+		{acceptEncoding: "deflate, gzip", want: "gzip"},
+		{acceptEncoding: "gzip;q=0.5, deflate", want: "deflate"},
+		{acceptEncoding: "GZIP;Q=0.8", want: "gzip"},
+		{acceptEncoding: "gzip;q=0", want: ""},
+		{acceptEncoding: "*", want: "gzip"},
+		{acceptEncoding: "*;q=0.5, gzip;q=0", want: "deflate"},
+		{acceptEncoding: "br, identity", want: ""},
+	}
+
+	for _, tc := range tcs {
+		if got := negotiateEncoding(tc.acceptEncoding); got != tc.want {
+			t.Errorf("%q: want: %q, got: %q", tc.acceptEncoding, tc.want, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"gopher"}`, 100)
+
+	tcs := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		header         map[string]string
+		status         int
+		body           string
+		wantEncoding   string
+		wantETag       string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: "application/json", body: large, wantEncoding: "gzip"},
+		{name: "deflate", acceptEncoding: "deflate", contentType: "application/json", body: large, wantEncoding: "deflate"},
+		{name: "text subtype", acceptEncoding: "gzip", contentType: "text/plain; charset=utf-8", body: large, wantEncoding: "gzip"},
+		{name: "detected content type", acceptEncoding: "gzip", body: large, wantEncoding: "gzip"},
+		{name: "not accepted", acceptEncoding: "br", contentType: "application/json", body: large},
+		{name: "too small", acceptEncoding: "gzip", contentType: "application/json", body: `{"name":"gopher"}`},
+		{name: "content type not allowed", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         map[string]string{"Content-Encoding": "br"},
+			body:           large,
+			wantEncoding:   "br",
+		},
+		{
+			name:           "small content length",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         map[string]string{"Content-Length": "17"},
+			body:           `{"name":"gopher"}`,
+		},
+		{
+			name:           "strong etag becomes weak",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         map[string]string{"ETag": `"v1"`},
+			body:           large,
+			wantEncoding:   "gzip",
+			wantETag:       `W/"v1"`,
+		},
+		{name: "status without body", acceptEncoding: "gzip", status: http.StatusNoContent},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				// several writes, so the buffering is exercised
+				for i := 0; i < len(tc.body); i += 100 {
+					end := i + 100
+					if end > len(tc.body) {
+						end = len(tc.body)
+					}
+					_, _ = w.Write([]byte(tc.body[i:end]))
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tc.wantEncoding {
+				t.Errorf("want Content-Encoding: %q, got: %q", tc.wantEncoding, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("want Vary: Accept-Encoding, got: %q", got)
+			}
+			if tc.wantETag != "" && w.Header().Get("ETag") != tc.wantETag {
+				t.Errorf("want ETag: %q, got: %q", tc.wantETag, w.Header().Get("ETag"))
+			}
+			if tc.wantEncoding == "gzip" || tc.wantEncoding == "deflate" {
+				if got := w.Header().Get("Content-Length"); got != "" {
+					t.Errorf("want no Content-Length, got: %q", got)
+				}
+			}
+
+			if got := decompress(t, tc.wantEncoding, w.Body); got != tc.body {
+				t.Errorf("want body: %q, got: %q", tc.body, got)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	chunks := make(chan string)
+	h := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for c := range chunks {
+			_, _ = w.Write([]byte(c))
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	chunks <- `{"n":1}` + "\n"
+	chunks <- `{"n":2}` + "\n"
+	close(chunks)
+	<-done
+
+	if !w.Flushed {
+		t.Error("want the response flushed")
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("want streams compressed even below the minimum size, got Content-Encoding: %q", got)
+	}
+	if got, want := decompress(t, "gzip", w.Body), "{\"n\":1}\n{\"n\":2}\n"; got != want {
+		t.Errorf("want body: %q, got: %q", want, got)
+	}
+}
+
+func TestCompressKeepsOptionalInterfaces(t *testing.T) {
+	var flusher, hijacker bool
+	h := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !flusher {
+		t.Error("want http.Flusher kept")
+	}
+	if hijacker {
+		t.Error("want no http.Hijacker, httptest.ResponseRecorder does not implement it")
+	}
+}
+
+func TestCompressResponseController(t *testing.T) {
+	var err error
+	h := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	dw := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(dw, r)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dw.deadline.IsZero() {
+		t.Error("want the deadline set on the underlying http.ResponseWriter")
+	}
+}
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("invalid gzip body: %v", err)
+		}
+		r = gz
+	case "deflate":
+		zl, err := zlib.NewReader(body)
+		if err != nil {
+			t.Fatalf("invalid deflate body: %v", err)
+		}
+		r = zl
+	default:
+		r = body
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("could not read body: %v", err)
+	}
+	return string(b)
+}
+
+func benchmarkCompress(b *testing.B, acceptEncoding string, body []byte) {
+	h := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", acceptEncoding)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		w.Body = &bytes.Buffer{}
+		h.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	large := bytes.Repeat([]byte(`{"name":"gopher","email":"gopher@example.com"}`), 1000)
+	small := []byte(`{"name":"gopher"}`)
+
+	b.Run("gzip 45KB", func(b *testing.B) { benchmarkCompress(b, "gzip", large) })
+	b.Run("deflate 45KB", func(b *testing.B) { benchmarkCompress(b, "deflate", large) })
+	b.Run("identity 45KB", func(b *testing.B) { benchmarkCompress(b, "identity", large) })
+	b.Run("gzip below min size", func(b *testing.B) { benchmarkCompress(b, "gzip", small) })
+}
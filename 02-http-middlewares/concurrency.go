@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// ConcurrencyLimit returns a middleware which caps the requests in flight using l. Requests
+// which cannot get a slot, because the wait queue is full or they waited for too long, even
+// if their context deadline passed on the queue, are shed with 503 Service Unavailable and a
+// JSON error body. Only the requests canceled by the client are not answered.
+//
+// Requests answered with 503 or 504, or whose context deadline passed, e.g. by Timeout,
+// count as dropped for the l limit algorithm. Use l.Limit, l.InFlight and l.QueueDepth
+// for metrics.
+func ConcurrencyLimit(l *ratelimit.ConcurrencyLimiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			done, err := l.Acquire(r.Context())
+			if err != nil {
+				if errors.Is(r.Context().Err(), context.Canceled) {
+					// the client is gone, no point in answering
+					return
+				}
+				tracking.WriteJSONError(w, r, http.StatusServiceUnavailable, "server overloaded: "+err.Error())
+				return
+			}
+
+			rw, ww := newResponseWriter(w)
+			dropped := true
+			defer func() { done(dropped) }()
+
+			next.ServeHTTP(ww, r)
+
+			status := rw.Status()
+			dropped = status == http.StatusServiceUnavailable ||
+				status == http.StatusGatewayTimeout ||
+				errors.Is(r.Context().Err(), context.DeadlineExceeded)
+		})
+	}
+}
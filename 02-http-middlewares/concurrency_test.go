@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	l := ratelimit.NewConcurrencyLimiter(ratelimit.ConcurrencyConfig{Limit: 1})
+
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	h := ConcurrencyLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler <- struct{}{}
+		<-release
+	}))
+
+	first := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		h.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(finished)
+	}()
+	<-inHandler
+
+	shed := httptest.NewRecorder()
+	h.ServeHTTP(shed, httptest.NewRequest(http.MethodGet, "/", nil))
+	if shed.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d, got: %d", http.StatusServiceUnavailable, shed.Code)
+	}
+	if got, want := shed.Body.String(), `{"error":"server overloaded: concurrency limit exceeded"}`+"\n"; got != want {
+		t.Errorf("want body: %q, got: %q", want, got)
+	}
+
+	close(release)
+	<-finished
+	if first.Code != http.StatusOK {
+		t.Errorf("want status: %d, got: %d", http.StatusOK, first.Code)
+	}
+	if got := l.InFlight(); got != 0 {
+		t.Errorf("want the slot released, got in flight: %d", got)
+	}
+}
+
+func TestConcurrencyLimitContextDone(t *testing.T) {
+	tcs := []struct {
+		name     string
+		ctx      func() (context.Context, context.CancelFunc)
+		wantCode int
+	}{
+		{
+			name: "deadline exceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			// not answered, left to net/http
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			l := ratelimit.NewConcurrencyLimiter(ratelimit.ConcurrencyConfig{Limit: 1, QueueSize: 1})
+			done, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer done(false)
+
+			h := ConcurrencyLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the handler should not be called")
+			}))
+
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("want status: %d, got: %d", tc.wantCode, w.Code)
+			}
+			if tc.wantCode == http.StatusOK && w.Body.Len() != 0 {
+				t.Errorf("want no body, got: %q", w.Body)
+			}
+		})
+	}
+}
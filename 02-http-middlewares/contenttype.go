@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// Content types set by JSONResponse and offered by Negotiate by default.
+const (
+	ContentTypeJSON   = "application/json; charset=utf-8"
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeText   = "text/plain; charset=utf-8"
+)
+
+// JSONResponse sets the response content type to ContentTypeJSON. Handlers can still override it.
+func JSONResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contentTypeKey struct{}
+
+// Negotiate returns a middleware choosing the response content type among offers, in order of
+// preference, according to the request Accept header. The chosen one is set as the response
+// content type, which handlers can override, and added to the request context, see
+// NegotiatedContentType. If none is acceptable it responds 406 Not Acceptable.
+// The default offers are ContentTypeJSON, ContentTypeNDJSON and ContentTypeText.
+func Negotiate(offers ...string) func(next http.Handler) http.Handler {
+	if len(offers) == 0 {
+		offers = []string{ContentTypeJSON, ContentTypeNDJSON, ContentTypeText}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ct := NegotiateContentType(r.Header.Get("Accept"), offers)
+			if ct == "" {
+				tracking.WriteJSONError(w, r, http.StatusNotAcceptable,
+					"none of the available content types is acceptable: "+strings.Join(offers, ", "))
+				return
+			}
+
+			w.Header().Set("Content-Type", ct)
+			w.Header().Add("Vary", "Accept")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contentTypeKey{}, ct)))
+		})
+	}
+}
+
+// NegotiatedContentType returns the content type chosen by Negotiate, or "" if there is none.
+func NegotiatedContentType(ctx context.Context) string {
+	ct, _ := ctx.Value(contentTypeKey{}).(string)
+	return ct
+}
+
+// NegotiateContentType returns the offer with the highest quality on the Accept header accept,
+// the first one on ties, or "" if none is acceptable. The quality of an offer is the one of the
+// most specific media range matching it, e.g. "text/plain" over "text/*" over "*/*".
+// An empty accept means anything is acceptable.
+func NegotiateContentType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		value, q := parseQuality(part)
+		i := strings.IndexByte(value, '/')
+		if i <= 0 {
+			continue
+		}
+		ranges = append(ranges, mediaRange{typ: value[:i], subtype: value[i+1:], q: q})
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, offer := range offers {
+		mt, _, err := mime.ParseMediaType(offer)
+		if err != nil {
+			continue
+		}
+		typ, subtype := mt, ""
+		if i := strings.IndexByte(mt, '/'); i > 0 {
+			typ, subtype = mt[:i], mt[i+1:]
+		}
+
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			var s int
+			switch {
+			case mr.typ == typ && mr.subtype == subtype:
+				s = 2
+			case mr.typ == typ && mr.subtype == "*":
+				s = 1
+			case mr.typ == "*" && mr.subtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,98 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONResponse(t *testing.T) {
+	tcs := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{name: "default", handler: func(w http.ResponseWriter, r *http.Request) {}, want: ContentTypeJSON},
+		{
+			name: "overridden",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/csv")
+			},
+			want: "text/csv",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			JSONResponse(tc.handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := w.Header().Get("Content-Type"); got != tc.want {
+				t.Errorf("want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{ContentTypeJSON, ContentTypeNDJSON, ContentTypeText}
+
+	tcs := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ContentTypeJSON},
+		{accept: "*/*", want: ContentTypeJSON},
+		{accept: "application/json", want: ContentTypeJSON},
+		{accept: "application/x-ndjson", want: ContentTypeNDJSON},
+		{accept: "text/*", want: ContentTypeText},
+		{accept: "text/html, text/plain;q=0.5", want: ContentTypeText},
+		{accept: "application/json;q=0.5, text/plain", want: ContentTypeText},
+		{accept: "text/plain;q=0.5, */*;q=0.1", want: ContentTypeText},
+		{accept: "application/*;q=0.8, application/x-ndjson", want: ContentTypeNDJSON},
+		{accept: "*/*, application/json;q=0", want: ContentTypeNDJSON},
+		{accept: "text/html", want: ""},
+		{accept: "image/png, application/json;q=0", want: ""},
+	}
+
+	for _, tc := range tcs {
+		if got := NegotiateContentType(tc.accept, offers); got != tc.want {
+			t.Errorf("%q: want: %q, got: %q", tc.accept, tc.want, got)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var negotiated string
+	h := Negotiate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiated = NegotiatedContentType(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if negotiated != ContentTypeNDJSON {
+		t.Errorf("want negotiated: %q, got: %q", ContentTypeNDJSON, negotiated)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentTypeNDJSON {
+		t.Errorf("want Content-Type: %q, got: %q", ContentTypeNDJSON, got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("want Vary: Accept, got: %q", got)
+	}
+
+	negotiated = ""
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("want status: %d, got: %d", http.StatusNotAcceptable, w.Code)
+	}
+	if negotiated != "" {
+		t.Error("want next handler not called")
+	}
+}
@@ -0,0 +1,239 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// CORSConfig configures the middleware returned by CORS. The config.Config CORS_* environment
+// variables map to its fields, see config.Config.CORSConfig.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests. An origin is either
+	// exact, e.g. "https://example.com", a wildcard subdomain, e.g. "https://*.example.com",
+	// matching any subdomain but not example.com itself, or "*" allowing any origin, which
+	// cannot be combined with AllowCredentials.
+	AllowedOrigins []string
+	// AllowedOriginRegexps are regular expressions matching the whole allowed origins,
+	// lowercased as the origins are case-insensitive.
+	AllowedOriginRegexps []string
+	// AllowOriginFunc, if set, is called for the origins not allowed by AllowedOrigins
+	// nor AllowedOriginRegexps.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// AllowedMethods defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed, "*" allows any. Defaults to Accept,
+	// Accept-Language, Content-Language, Content-Type and the tracking id header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers the browser lets the clients read.
+	ExposedHeaders []string
+	// AllowCredentials lets the clients send cookies and authorization headers.
+	AllowCredentials bool
+	// MaxAge is for how long the browser caches the preflight response, zero means
+	// the browser default.
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware implementing Cross-Origin Resource Sharing as configured by cfg.
+// Preflight requests are answered with 204 No Content without calling the next handler.
+// Requests from origins not allowed get no CORS headers, so the browser blocks them.
+// It returns an error if any of cfg.AllowedOriginRegexps is invalid or if cfg allows any origin
+// with credentials, which would let any site make credentialed requests.
+func CORS(cfg CORSConfig) (func(next http.Handler) http.Handler, error) {
+	c := &cors{
+		allowCredentials: cfg.AllowCredentials,
+		allowOriginFunc:  cfg.AllowOriginFunc,
+		methods:          cfg.AllowedMethods,
+		exposed:          strings.Join(cfg.ExposedHeaders, ", "),
+		headers:          map[string]bool{},
+	}
+
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			c.allowAll = true
+		case strings.Contains(o, "://*."):
+			i := strings.Index(o, "*")
+			c.wildcards = append(c.wildcards, [2]string{o[:i], o[i+1:]})
+		default:
+			c.origins = append(c.origins, o)
+		}
+	}
+
+	if c.allowAll && c.allowCredentials {
+		return nil, errors.New(`CORS cannot allow credentials from any origin, "*"`)
+	}
+
+	for _, expr := range cfg.AllowedOriginRegexps {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid CORS origin regexp %q: %w", expr, err)
+		}
+		c.regexps = append(c.regexps, re)
+	}
+
+	if len(c.methods) == 0 {
+		c.methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", tracking.Header}
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.allowAllHeaders = true
+		}
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	if cfg.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+
+	return c.handler, nil
+}
+
+type cors struct {
+	allowAll         bool
+	origins          []string
+	wildcards        [][2]string
+	regexps          []*regexp.Regexp
+	allowOriginFunc  func(r *http.Request, origin string) bool
+	allowCredentials bool
+
+	methods         []string
+	headers         map[string]bool
+	allowAllHeaders bool
+	exposed         string
+	maxAge          string
+}
+
+func (c *cors) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r)
+			return
+		}
+
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+
+		// the response is the same for all origins if any origin is allowed
+		if !c.allowAll {
+			h.Add("Vary", "Origin")
+		}
+
+		if origin != "" && c.allowOrigin(r, origin) {
+			c.setAllowOrigin(h, origin)
+			if c.exposed != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	reqHeaders := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+
+	if origin == "" || !c.allowOrigin(r, origin) || !c.allowMethod(method) || !c.allowHeaders(reqHeaders) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setAllowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) setAllowOrigin(h http.Header, origin string) {
+	if c.allowAll {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) allowOrigin(r *http.Request, origin string) bool {
+	if c.allowAll {
+		return true
+	}
+
+	o := strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if o == allowed {
+			return true
+		}
+	}
+	for _, w := range c.wildcards {
+		// the wildcard must match at least one character
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, re := range c.regexps {
+		if re.MatchString(o) {
+			return true
+		}
+	}
+
+	return c.allowOriginFunc != nil && c.allowOriginFunc(r, origin)
+}
+
+func (c *cors) allowMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) allowHeaders(headers []string) bool {
+	if c.allowAllHeaders {
+		return true
+	}
+	for _, h := range headers {
+		if !c.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeaderList parses a comma separated list of header names.
+func parseHeaderList(list string) []string {
+	var headers []string
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
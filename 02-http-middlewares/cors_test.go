@@ -0,0 +1,217 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	mw, err := CORS(CORSConfig{
+		AllowedOrigins:       []string{"https://example.com", "https://*.example.org"},
+		AllowedOriginRegexps: []string{`https://app-[0-9]+\.example\.net`},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return origin == "https://func.example"
+		},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"content-type", "X-TrackingId"},
+		ExposedHeaders:   []string{"X-TrackingId"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var called bool
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	tcs := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		wantCalled  bool
+		wantStatus  int
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "no origin",
+			method:     http.MethodGet,
+			wantCalled: true,
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:       "exact origin",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://example.com"},
+			wantCalled: true,
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-TrackingId",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:        "wildcard subdomain",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://api.example.org"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://api.example.org"},
+		},
+		{
+			name:        "wildcard does not match the bare domain",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://example.org"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "regexp",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://app-42.example.net"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://app-42.example.net"},
+		},
+		{
+			name:        "regexp is case-insensitive",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://APP-42.Example.net"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://APP-42.Example.net"},
+		},
+		{
+			name:        "regexp matches the whole origin",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://app-42.example.net.evil.com"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "func",
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://func.example"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://func.example"},
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodPut,
+				"Access-Control-Request-Headers": "content-type, x-trackingid",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Allow-Headers":     "content-type, x-trackingid",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:   "preflight method not allowed",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:   "preflight header not allowed",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "plain OPTIONS is not a preflight",
+			method:      http.MethodOptions,
+			headers:     map[string]string{"Origin": "https://example.com"},
+			wantCalled:  true,
+			wantStatus:  http.StatusOK,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://example.com"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			called = false
+			r := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if called != tc.wantCalled {
+				t.Errorf("want next called: %t, got: %t", tc.wantCalled, called)
+			}
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			for k, want := range tc.wantHeaders {
+				if got := strings.Join(w.Header()[k], ", "); got != want {
+					t.Errorf("want %s: %q, got: %q", k, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	mw, err := CORS(CORSConfig{AllowedOrigins: []string{"*"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://anywhere.example")
+	w := httptest.NewRecorder()
+	mw(noop).ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("want Access-Control-Allow-Origin: *, got: %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "" {
+		t.Errorf("want no Vary header, got: %q", got)
+	}
+}
+
+func TestCORSInvalidRegexp(t *testing.T) {
+	if _, err := CORS(CORSConfig{AllowedOriginRegexps: []string{"("}}); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
+
+func TestCORSAllowAllWithCredentials(t *testing.T) {
+	_, err := CORS(CORSConfig{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true})
+	if err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
@@ -0,0 +1,336 @@
+package middlewares
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// ETagConfig configures the middleware returned by ETag.
+type ETagConfig struct {
+	// Weak makes the generated ETags weak, W/"...", which If-Match never matches. Defaults to strong.
+	Weak bool
+	// MaxSize is the maximum response size, in bytes, buffered to compute the ETag, defaults to
+	// 1MB. Larger responses are sent as they are written, without an ETag.
+	MaxSize int
+	// CurrentETag returns the current ETag of the resource r targets, and whether it exists, to
+	// check the If-Match and If-None-Match preconditions of requests changing it.
+	// Defaults to serving a GET to the same URL to the next handler and computing its ETag.
+	CurrentETag func(r *http.Request) (etag string, exists bool)
+}
+
+// ETag returns a middleware which adds an ETag to the 200 OK responses to GET and HEAD requests,
+// computed from the body, unless the handler set one, and answers the ones whose If-None-Match
+// matches it with 304 Not Modified. Use it inside Compress, which turns strong ETags weak.
+//
+// On the other methods it enforces the If-Match and If-None-Match preconditions, answering
+// 412 Precondition Failed when they do not hold, so clients can update a resource only if it did
+// not change since they read it. The check and the change are not atomic, handlers needing it
+// must check it again while changing the resource.
+func ETag(cfg ETagConfig) func(next http.Handler) http.Handler {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		currentETag := cfg.CurrentETag
+		if currentETag == nil {
+			currentETag = func(r *http.Request) (string, bool) {
+				return serveETag(next, r, cfg)
+			}
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				if !checkPreconditions(r, currentETag) {
+					tracking.WriteJSONError(w, r, http.StatusPreconditionFailed,
+						"the resource does not match the If-Match or If-None-Match preconditions")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, maxSize: cfg.MaxSize}
+			next.ServeHTTP(wrapOptionalInterfaces(w, ew), r)
+			ew.finish(r, cfg.Weak)
+		})
+	}
+}
+
+// checkPreconditions reports whether the If-Match and If-None-Match preconditions of r hold.
+func checkPreconditions(r *http.Request, currentETag func(r *http.Request) (string, bool)) bool {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return true
+	}
+
+	etag, exists := currentETag(r)
+	if ifMatch != "" && !(exists && matchETag(ifMatch, etag, true)) {
+		return false
+	}
+	if ifNoneMatch != "" && exists && matchETag(ifNoneMatch, etag, false) {
+		return false
+	}
+	return true
+}
+
+// serveETag serves a GET to the URL of r to next and returns the ETag of the response, if any,
+// and whether it was successful.
+func serveETag(next http.Handler, r *http.Request, cfg ETagConfig) (string, bool) {
+	get := r.Clone(r.Context())
+	get.Method = http.MethodGet
+	get.Body = http.NoBody
+	get.ContentLength = 0
+	for _, h := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range"} {
+		get.Header.Del(h)
+	}
+
+	rec := &hashRecorder{header: http.Header{}, hash: sha256.New()}
+	next.ServeHTTP(rec, get)
+
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.status < 200 || rec.status > 299 {
+		return "", false
+	}
+	if etag := rec.header.Get("ETag"); etag != "" {
+		return etag, true
+	}
+	if rec.status != http.StatusOK || rec.size > int64(cfg.MaxSize) {
+		return "", true
+	}
+	return formatETag(rec.hash, cfg.Weak), true
+}
+
+// hashRecorder is a http.ResponseWriter which only keeps the status, the header and the hash
+// of the body.
+type hashRecorder struct {
+	header http.Header
+	status int
+	hash   hash.Hash
+	size   int64
+}
+
+func (r *hashRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *hashRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 && statusCode >= 200 {
+		r.status = statusCode
+	}
+}
+
+func (r *hashRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	r.size += int64(len(b))
+	return r.hash.Write(b)
+}
+
+// etagWriter buffers the response to compute its ETag, up to maxSize bytes.
+type etagWriter struct {
+	http.ResponseWriter
+	maxSize int
+
+	status      int
+	wroteHeader bool
+	// passthrough is set once the response is being sent as written, without an ETag
+	passthrough bool
+	buf         []byte
+}
+
+func (w *etagWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.passthrough {
+		return
+	}
+
+	// informational responses go straight through
+	if statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	w.status = statusCode
+	w.wroteHeader = true
+	if statusCode != http.StatusOK {
+		_ = w.startPassthrough()
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) > w.maxSize {
+		if err := w.startPassthrough(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the response as written so far, which then goes without an ETag.
+func (w *etagWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passthrough {
+		_ = w.startPassthrough()
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.passthrough = true
+	}
+	return conn, rw, err
+}
+
+func (w *etagWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom copies src through Write, so the body is buffered.
+func (w *etagWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, it's used by http.ResponseController.
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// startPassthrough writes the header and the buffered body.
+func (w *etagWriter) startPassthrough() error {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sets the ETag and writes the buffered response, or 304 Not Modified if the
+// If-None-Match of r matches the ETag.
+func (w *etagWriter) finish(r *http.Request, weak bool) {
+	if w.passthrough {
+		return
+	}
+
+	h := w.Header()
+	etag := h.Get("ETag")
+	// handlers may answer HEAD requests with the Content-Length alone, there is no body to hash
+	headWithoutBody := r.Method == http.MethodHead && len(w.buf) == 0 && h.Get("Content-Length") != "" && h.Get("Content-Length") != "0"
+	if etag == "" && !headWithoutBody {
+		sum := sha256.New()
+		sum.Write(w.buf)
+		etag = formatETag(sum, weak)
+		h.Set("ETag", etag)
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etag != "" && matchETag(inm, etag, false) {
+		// as http.ServeContent does
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		h.Del("Content-Encoding")
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if h.Get("Content-Length") == "" {
+		h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_, _ = w.ResponseWriter.Write(w.buf)
+}
+
+// formatETag returns the quoted ETag for the hash of a body.
+func formatETag(h hash.Hash, weak bool) string {
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// matchETag reports whether the If-Match or If-None-Match header value matches etag, using the
+// strong comparison, where weak ETags never match, if strong is set.
+func matchETag(header, etag string, strong bool) bool {
+	if etag == "" {
+		return strings.TrimSpace(header) == "*"
+	}
+
+	s := header
+	for {
+		s = textproto.TrimString(s)
+		if s == "" {
+			return false
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		if s[0] == '*' {
+			return true
+		}
+
+		tag, rest := scanETag(s)
+		if tag == "" {
+			return false
+		}
+		if strong {
+			if !strings.HasPrefix(tag, "W/") && !strings.HasPrefix(etag, "W/") && tag == etag {
+				return true
+			}
+		} else if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+		s = rest
+	}
+}
+
+// scanETag returns the ETag at the start of s, or "" if there is none, and the rest of s.
+func scanETag(s string) (etag, rest string) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		// etagc, RFC 7232 section 2.3
+		case c == 0x21 || c >= 0x23 && c <= 0x7E || c >= 0x80:
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
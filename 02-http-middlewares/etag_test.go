@@ -0,0 +1,247 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	body := `{"users":["gopher"]}`
+	h := ETag(ETagConfig{MaxSize: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/own-etag":
+			w.Header().Set("ETag", `"v1"`)
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 65)))
+			return
+		case "/stream":
+			_, _ = w.Write([]byte(body))
+			w.(http.Flusher).Flush()
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		_, _ = w.Write([]byte(body))
+	}))
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/users", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("want 200 with the body, got: %d %q", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(etag, `"`) || len(etag) != 34 {
+		t.Fatalf("want a strong ETag, got: %q", etag)
+	}
+	if got := w.Header().Get("Content-Length"); got != "20" {
+		t.Errorf("want Content-Length: 20, got: %q", got)
+	}
+	if again := get("/users", "").Header().Get("ETag"); again != etag {
+		t.Errorf("want the same ETag for the same body, got: %q and %q", etag, again)
+	}
+
+	tcs := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    string
+	}{
+		{name: "matching", path: "/users", ifNoneMatch: etag, wantStatus: http.StatusNotModified, wantETag: etag},
+		{name: "matching weakly", path: "/users", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified, wantETag: etag},
+		{name: "any", path: "/users", ifNoneMatch: "*", wantStatus: http.StatusNotModified, wantETag: etag},
+		{name: "not matching", path: "/users", ifNoneMatch: `"other"`, wantStatus: http.StatusOK, wantETag: etag},
+		{name: "handler ETag", path: "/own-etag", ifNoneMatch: `"v1"`, wantStatus: http.StatusNotModified, wantETag: `"v1"`},
+		{name: "not found", path: "/missing", ifNoneMatch: "*", wantStatus: http.StatusNotFound},
+		{name: "larger than MaxSize", path: "/large", ifNoneMatch: "*", wantStatus: http.StatusOK},
+		{name: "flushed", path: "/stream", ifNoneMatch: "*", wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(tc.path, tc.ifNoneMatch)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != tc.wantETag {
+				t.Errorf("want ETag: %q, got: %q", tc.wantETag, got)
+			}
+			if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "") {
+				t.Errorf("want no body nor Content-Type on 304, got: %q %q", w.Header().Get("Content-Type"), w.Body)
+			}
+			if w.Code == http.StatusOK && w.Body.Len() == 0 {
+				t.Error("want the body on 200, got none")
+			}
+		})
+	}
+}
+
+func TestETagWeak(t *testing.T) {
+	h := ETag(ETagConfig{Weak: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("ETag"); !strings.HasPrefix(got, `W/"`) {
+		t.Errorf("want a weak ETag, got: %q", got)
+	}
+}
+
+func TestETagPreconditions(t *testing.T) {
+	var users string
+	var updates int
+	h := ETag(ETagConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if users == "" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(users))
+		case http.MethodPut:
+			updates++
+			users = "updated"
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	users = "original"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	etag := w.Header().Get("ETag")
+
+	tcs := []struct {
+		name        string
+		users       string
+		ifMatch     string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "no preconditions", users: "original", wantStatus: http.StatusNoContent},
+		{name: "If-Match current", users: "original", ifMatch: etag, wantStatus: http.StatusNoContent},
+		{name: "If-Match one of", users: "original", ifMatch: `"other", ` + etag, wantStatus: http.StatusNoContent},
+		{name: "If-Match stale", users: "changed", ifMatch: etag, wantStatus: http.StatusPreconditionFailed},
+		{name: "If-Match weak", users: "original", ifMatch: "W/" + etag, wantStatus: http.StatusPreconditionFailed},
+		{name: "If-Match any existing", users: "changed", ifMatch: "*", wantStatus: http.StatusNoContent},
+		{name: "If-Match any missing", ifMatch: "*", wantStatus: http.StatusPreconditionFailed},
+		{name: "If-None-Match any missing", ifNoneMatch: "*", wantStatus: http.StatusNoContent},
+		{name: "If-None-Match any existing", users: "original", ifNoneMatch: "*", wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			users, updates = tc.users, 0
+
+			r := httptest.NewRequest(http.MethodPut, "/users", strings.NewReader("updated"))
+			if tc.ifMatch != "" {
+				r.Header.Set("If-Match", tc.ifMatch)
+			}
+			if tc.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			wantUpdates := 0
+			if tc.wantStatus == http.StatusNoContent {
+				wantUpdates = 1
+			}
+			if updates != wantUpdates {
+				t.Errorf("want %d updates, got: %d", wantUpdates, updates)
+			}
+		})
+	}
+}
+
+func TestETagCurrentETag(t *testing.T) {
+	var called bool
+	h := ETag(ETagConfig{
+		CurrentETag: func(r *http.Request) (string, bool) { return `"v2"`, true },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			t.Error("want no GET served to check the preconditions")
+		}
+		called = true
+	}))
+
+	for _, tc := range []struct {
+		ifMatch    string
+		wantCalled bool
+	}{
+		{ifMatch: `"v1"`, wantCalled: false},
+		{ifMatch: `"v2"`, wantCalled: true},
+	} {
+		called = false
+		r := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		r.Header.Set("If-Match", tc.ifMatch)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		if called != tc.wantCalled {
+			t.Errorf("If-Match %s: want handler called: %t, got: %t", tc.ifMatch, tc.wantCalled, called)
+		}
+	}
+}
+
+func TestETagResponseController(t *testing.T) {
+	var err error
+	h := ETag(ETagConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	}))
+
+	dw := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(dw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dw.deadline.IsZero() {
+		t.Error("want the deadline set on the underlying http.ResponseWriter")
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	tcs := []struct {
+		header string
+		etag   string
+		strong bool
+		want   bool
+	}{
+		{header: `"a"`, etag: `"a"`, strong: true, want: true},
+		{header: `"a"`, etag: `"b"`, want: false},
+		{header: `W/"a"`, etag: `"a"`, want: true},
+		{header: `W/"a"`, etag: `"a"`, strong: true, want: false},
+		{header: `"a"`, etag: `W/"a"`, strong: true, want: false},
+		{header: ` "x" ,, "a,b" `, etag: `"a,b"`, strong: true, want: true},
+		{header: `*`, etag: `"a"`, want: true},
+		{header: `*`, etag: "", want: true},
+		{header: `"a"`, etag: "", want: false},
+		{header: `a`, etag: `"a"`, want: false},
+		{header: `"a`, etag: `"a"`, want: false},
+	}
+
+	for _, tc := range tcs {
+		if got := matchETag(tc.header, tc.etag, tc.strong); got != tc.want {
+			t.Errorf("%q against %q, strong: %t: want: %t, got: %t", tc.header, tc.etag, tc.strong, tc.want, got)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package middlewares
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
 	"github.com/rs/zerolog"
 )
 
@@ -10,14 +12,57 @@ func TrackingID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 }
 
+// LogRequest returns a middleware which logs every request once it's finished with its status code,
+// response size, duration, method, path, remote address, user agent and tracking id. The log level
+// depends on the status code: info for 1xx, 2xx and 3xx, warn for 4xx and error for 5xx.
+// Sampled requests, see tracking.Sampled, are also logged in detail at debug level.
 func LogRequest(logger zerolog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			next.ServeHTTP(w, r)
-			logger.Info().Msg("request finished")
+			start := time.Now()
+			rw, ww := newResponseWriter(w)
+
+			next.ServeHTTP(ww, r)
+
+			ctx := r.Context()
+			status := rw.Status()
+			logger.WithLevel(levelForStatus(status)).
+				Str("tracking_id", tracking.IdFromContext(ctx)).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("remote_addr", r.RemoteAddr).
+				Str("user_agent", r.UserAgent()).
+				Int("status", status).
+				Int64("bytes", rw.BytesWritten()).
+				Dur("duration", time.Since(start)).
+				Msg("request finished")
+
+			// debug details only for sampled requests, so they can be enabled in production
+			if tracking.Sampled(ctx) {
+				logger.Debug().
+					Str("tracking_id", tracking.IdFromContext(ctx)).
+					Str("trace_id", tracking.TraceIDFromContext(ctx)).
+					Str("span_id", tracking.SpanIDFromContext(ctx)).
+					Str("url", r.URL.String()).
+					Str("host", r.Host).
+					Str("proto", r.Proto).
+					Str("referer", r.Referer()).
+					Int64("content_length", r.ContentLength).
+					Msg("request details")
+			}
 		})
 	}
+}
 
+func levelForStatus(status int) zerolog.Level {
+	switch {
+	case status >= 500:
+		return zerolog.ErrorLevel
+	case status >= 400:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.InfoLevel
+	}
 }
 
 func a() {
@@ -1,11 +1,15 @@
 package middlewares
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
 )
 
 func TestTrackingID(t *testing.T) {
@@ -24,3 +28,95 @@ func TestTrackingID(t *testing.T) {
 		t.Error("expected a tracking id, got an empty string")
 	}
 }
+
+func TestLogRequestSampled(t *testing.T) {
+	tcs := []struct {
+		name        string
+		sampled     bool
+		wantDetails bool
+	}{
+		{name: "sampled", sampled: true, wantDetails: true},
+		{name: "not sampled", sampled: false, wantDetails: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			trace, err := tracking.NewTraceContext()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			trace.Flags = trace.Flags.WithSampled(tc.sampled)
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			r = r.WithContext(tracking.ContextWithTrace(r.Context(), trace))
+			w := httptest.NewRecorder()
+
+			buff := &bytes.Buffer{}
+			logger := zerolog.New(buff).Level(zerolog.DebugLevel)
+
+			h := LogRequest(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			h.ServeHTTP(w, r)
+
+			if got := strings.Contains(buff.String(), "request details"); got != tc.wantDetails {
+				t.Errorf("want debug details: %t, got: %t, logs: %s", tc.wantDetails, got, buff)
+			}
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	tcs := []struct {
+		name      string
+		status    int
+		body      string
+		wantLevel string
+	}{
+		{name: "2xx", status: http.StatusOK, body: "hello", wantLevel: "info"},
+		{name: "3xx", status: http.StatusFound, wantLevel: "info"},
+		{name: "4xx", status: http.StatusNotFound, body: "not found", wantLevel: "warn"},
+		{name: "5xx", status: http.StatusServiceUnavailable, wantLevel: "error"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "https://example.com/users?page=2", nil)
+			r.Header.Set("User-Agent", "gopher")
+			r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+			w := httptest.NewRecorder()
+
+			buff := &bytes.Buffer{}
+			logger := zerolog.New(buff)
+
+			h := LogRequest(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			h.ServeHTTP(w, r)
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buff.Bytes(), &got); err != nil {
+				t.Fatalf("invalid log line %q: %v", buff, err)
+			}
+
+			want := map[string]interface{}{
+				"level":       tc.wantLevel,
+				"message":     "request finished",
+				"tracking_id": "some-id",
+				"method":      http.MethodPost,
+				"path":        "/users",
+				"remote_addr": "192.0.2.1:1234",
+				"user_agent":  "gopher",
+				"status":      float64(tc.status),
+				"bytes":       float64(len(tc.body)),
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("want %s: %v, got: %v", k, v, got[k])
+				}
+			}
+			if _, ok := got["duration"]; !ok {
+				t.Error("expected duration to be logged")
+			}
+		})
+	}
+}
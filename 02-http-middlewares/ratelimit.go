@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// KeyFunc returns the key a request is rate limited by. An empty key means the client IP.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP rate limits by the client IP, as seen on http.Request.RemoteAddr.
+func KeyByIP(r *http.Request) string {
+	return remoteHost(r)
+}
+
+// KeyByPrincipal rate limits by the auth.Principal authenticated by auth.Middleware, which must
+// run before RateLimit. Anonymous requests are limited by the client IP. Keying on credentials
+// sent by the client, e.g. an API key header, would let it get a new bucket on every request
+// by sending a new one.
+func KeyByPrincipal(r *http.Request) string {
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok && p.ID != "" {
+		return "principal:" + p.ID
+	}
+	return ""
+}
+
+// KeyByHeader rate limits by the value of the header, e.g. X-Real-IP set by a trusted proxy.
+func KeyByHeader(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(header); v != "" {
+			return header + ":" + v
+		}
+		return ""
+	}
+}
+
+// RateLimit returns a middleware which rate limits the requests by the key returned by key,
+// KeyByIP if nil. Requests without a key are limited by the client IP, so clients cannot
+// get around the limit by not sending one.
+//
+// All responses carry the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// Rejected requests get 429 Too Many Requests with a Retry-After header and a JSON error body.
+func RateLimit(l *ratelimit.Limiter, key KeyFunc) func(next http.Handler) http.Handler {
+	if key == nil {
+		key = KeyByIP
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				k = KeyByIP(r)
+			}
+
+			res := l.Take(k)
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+				tracking.WriteJSONError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers do not take fractions.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,294 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLimitExceeded is returned by ConcurrencyLimiter.Acquire when the limit is reached
+	// and the wait queue is full.
+	ErrLimitExceeded = errors.New("concurrency limit exceeded")
+	// ErrQueueTimeout is returned by ConcurrencyLimiter.Acquire when it waited on the queue
+	// for longer than ConcurrencyConfig.QueueTimeout.
+	ErrQueueTimeout = errors.New("timed out waiting for the concurrency limit")
+)
+
+// LimitAlgorithm adapts the concurrency limit from the observed latency. Update is called
+// every time a request finishes, with the current limit, the request round trip time, the
+// number of requests in flight, including the finished one, and whether the request was
+// dropped, e.g. timed out. It returns the new limit.
+// Update is always called by one goroutine at a time.
+type LimitAlgorithm interface {
+	Update(limit int, rtt time.Duration, inFlight int, dropped bool) int
+}
+
+// AIMD is an additive increase, multiplicative decrease LimitAlgorithm: the limit grows by one
+// for every request finished in time while the limit is being used, and it's multiplied by
+// BackoffRatio for every dropped request or request slower than Timeout.
+type AIMD struct {
+	// Min and Max bound the limit, they default to 1 and 1000.
+	Min, Max int
+	// BackoffRatio in (0, 1) the limit is multiplied by on drops, defaults to 0.9.
+	BackoffRatio float64
+	// Timeout is the round trip time above which a request counts as dropped, zero means none.
+	Timeout time.Duration
+}
+
+func (a AIMD) Update(limit int, rtt time.Duration, inFlight int, dropped bool) int {
+	min, max := bounds(a.Min, a.Max)
+	ratio := a.BackoffRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.9
+	}
+
+	switch {
+	case dropped || (a.Timeout > 0 && rtt > a.Timeout):
+		limit = int(float64(limit) * ratio)
+	case inFlight*2 >= limit:
+		// only grow when the limit is actually being used
+		limit++
+	}
+
+	return clamp(limit, min, max)
+}
+
+// Gradient is a LimitAlgorithm inspired by Netflix's concurrency-limits Gradient2. It keeps a
+// long term average of the round trip time and shrinks the limit as the round trip time grows
+// above it, which means requests are queuing somewhere. While the latency is stable the limit
+// grows by its square root, leaving room for bursts.
+// A Gradient holds state, do not share it between limiters.
+type Gradient struct {
+	// Min and Max bound the limit, they default to 1 and 1000.
+	Min, Max int
+	// Smoothing in (0, 1] is how fast the limit moves towards the new estimate, defaults to 0.2.
+	Smoothing float64
+	// Tolerance is how many times slower than the long term average requests can get before
+	// the limit is reduced, defaults to 1.5.
+	Tolerance float64
+	// Window is the number of requests the long term average is computed over, defaults to 600.
+	Window int
+
+	estimate float64
+	longRTT  float64
+}
+
+func (g *Gradient) Update(limit int, rtt time.Duration, inFlight int, dropped bool) int {
+	min, max := bounds(g.Min, g.Max)
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	window := g.Window
+	if window <= 0 {
+		window = 600
+	}
+
+	if g.estimate == 0 {
+		g.estimate = float64(limit)
+	}
+
+	if dropped {
+		g.estimate = math.Max(float64(min), g.estimate/2)
+		return clamp(int(g.estimate), min, max)
+	}
+
+	short := float64(rtt)
+	if g.longRTT == 0 {
+		g.longRTT = short
+	} else {
+		g.longRTT += (short - g.longRTT) * 2 / float64(window+1)
+	}
+
+	// the limit is not being used, there is nothing to learn about it
+	if float64(inFlight)*2 < g.estimate {
+		return clamp(int(g.estimate), min, max)
+	}
+
+	gradient := math.Max(0.5, math.Min(1, tolerance*g.longRTT/short))
+	next := g.estimate*gradient + math.Sqrt(g.estimate)
+	g.estimate = math.Max(float64(min), math.Min(float64(max), g.estimate*(1-smoothing)+next*smoothing))
+
+	return clamp(int(g.estimate), min, max)
+}
+
+// ConcurrencyConfig configures a ConcurrencyLimiter.
+type ConcurrencyConfig struct {
+	// Limit is the maximum number of requests in flight, or the initial one if Algorithm is
+	// set. Defaults to 100.
+	Limit int
+	// Algorithm adapts the limit, nil means a fixed limit.
+	Algorithm LimitAlgorithm
+	// QueueSize is how many requests can wait for the limit, zero means none.
+	QueueSize int
+	// QueueTimeout is how long a request waits on the queue, zero means until its context is done.
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyLimiter limits the number of requests in flight. Requests above the limit wait
+// on a bounded FIFO queue and are rejected when it's full. It's safe for concurrent use.
+type ConcurrencyLimiter struct {
+	cfg ConcurrencyConfig
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	queue    []*waiter
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter.
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.Limit <= 0 {
+		cfg.Limit = 100
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+
+	return &ConcurrencyLimiter{cfg: cfg, limit: cfg.Limit}
+}
+
+// Acquire takes a slot, waiting on the queue if the limit is reached. It returns
+// ErrLimitExceeded if the queue is full, ErrQueueTimeout if it waited for too long or
+// ctx.Err() if ctx is done first.
+//
+// On success done must be called once the request finishes, with dropped telling whether
+// it failed because of the load, e.g. it timed out. It feeds the limit algorithm.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (done func(dropped bool), err error) {
+	l.mu.Lock()
+	if l.inFlight < l.limit && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.release(time.Now()), nil
+	}
+	if len(l.queue) >= l.cfg.QueueSize {
+		l.mu.Unlock()
+		return nil, ErrLimitExceeded
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.cfg.QueueTimeout > 0 {
+		t := time.NewTimer(l.cfg.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-w.ready:
+		return l.release(time.Now()), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrQueueTimeout
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the slot might have been granted while giving up, keep it
+	if w.granted {
+		return l.release(time.Now()), nil
+	}
+	l.remove(w)
+	return nil, err
+}
+
+// Limit returns the current limit.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
+
+// InFlight returns the number of requests holding a slot.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight
+}
+
+// QueueDepth returns the number of requests waiting for a slot.
+func (l *ConcurrencyLimiter) QueueDepth() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.queue)
+}
+
+func (l *ConcurrencyLimiter) release(start time.Time) func(dropped bool) {
+	var once sync.Once
+
+	return func(dropped bool) {
+		once.Do(func() {
+			rtt := time.Since(start)
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if l.cfg.Algorithm != nil {
+				l.limit = l.cfg.Algorithm.Update(l.limit, rtt, l.inFlight, dropped)
+				if l.limit < 1 {
+					l.limit = 1
+				}
+			}
+			l.inFlight--
+
+			for l.inFlight < l.limit && len(l.queue) > 0 {
+				w := l.queue[0]
+				l.queue[0] = nil
+				l.queue = l.queue[1:]
+
+				w.granted = true
+				l.inFlight++
+				close(w.ready)
+			}
+		})
+	}
+}
+
+func (l *ConcurrencyLimiter) remove(w *waiter) {
+	for i, qw := range l.queue {
+		if qw == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func bounds(min, max int) (int, int) {
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 1000
+	}
+	return min, max
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
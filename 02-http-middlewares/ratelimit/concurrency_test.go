@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterFixed(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 2, QueueSize: 1, QueueTimeout: time.Second})
+
+	done1, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	done2, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acquired := make(chan func(bool))
+	go func() {
+		done, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		acquired <- done
+	}()
+
+	waitFor(t, func() bool { return l.QueueDepth() == 1 })
+
+	if _, err := l.Acquire(context.Background()); err != ErrLimitExceeded {
+		t.Errorf("want: %v, got: %v", ErrLimitExceeded, err)
+	}
+
+	done1(false)
+	done3 := <-acquired
+	if got := l.InFlight(); got != 2 {
+		t.Errorf("want 2 in flight, got: %d", got)
+	}
+	if got := l.QueueDepth(); got != 0 {
+		t.Errorf("want empty queue, got: %d", got)
+	}
+
+	done2(false)
+	done3(false)
+	done3(false) // calling done twice must not release twice
+	if got := l.InFlight(); got != 0 {
+		t.Errorf("want 0 in flight, got: %d", got)
+	}
+	if got := l.Limit(); got != 2 {
+		t.Errorf("want fixed limit 2, got: %d", got)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond})
+
+	done, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer done(false)
+
+	if _, err := l.Acquire(context.Background()); err != ErrQueueTimeout {
+		t.Errorf("want: %v, got: %v", ErrQueueTimeout, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); err != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+
+	if got := l.QueueDepth(); got != 0 {
+		t.Errorf("want requests which gave up removed from the queue, got depth: %d", got)
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	a := AIMD{Min: 2, Max: 10, BackoffRatio: 0.5, Timeout: time.Second}
+
+	tcs := []struct {
+		name     string
+		limit    int
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		want     int
+	}{
+		{name: "increase", limit: 4, rtt: time.Millisecond, inFlight: 2, want: 5},
+		{name: "limit not used", limit: 4, rtt: time.Millisecond, inFlight: 1, want: 4},
+		{name: "max", limit: 10, rtt: time.Millisecond, inFlight: 10, want: 10},
+		{name: "dropped", limit: 8, rtt: time.Millisecond, inFlight: 8, dropped: true, want: 4},
+		{name: "too slow", limit: 8, rtt: 2 * time.Second, inFlight: 8, want: 4},
+		{name: "min", limit: 3, rtt: time.Millisecond, inFlight: 3, dropped: true, want: 2},
+	}
+
+	for _, tc := range tcs {
+		if got := a.Update(tc.limit, tc.rtt, tc.inFlight, tc.dropped); got != tc.want {
+			t.Errorf("%s: want: %d, got: %d", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g := &Gradient{Min: 1, Max: 100, Window: 10}
+
+	limit := 10
+	for i := 0; i < 20; i++ {
+		limit = g.Update(limit, 10*time.Millisecond, limit, false)
+	}
+	grown := limit
+	if grown <= 10 {
+		t.Errorf("want the limit to grow while latency is stable, got: %d", grown)
+	}
+
+	for i := 0; i < 5; i++ {
+		limit = g.Update(limit, 100*time.Millisecond, limit, false)
+	}
+	if limit >= grown {
+		t.Errorf("want the limit to shrink when latency grows, was: %d, got: %d", grown, limit)
+	}
+
+	if got := g.Update(limit, 10*time.Millisecond, limit, true); got > limit/2+1 {
+		t.Errorf("want the limit halved on drops, was: %d, got: %d", limit, got)
+	}
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 4, Algorithm: AIMD{BackoffRatio: 0.5}})
+
+	done, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	done(true)
+
+	if got := l.Limit(); got != 2 {
+		t.Errorf("want limit: 2, got: %d", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
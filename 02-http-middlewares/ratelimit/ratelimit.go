@@ -0,0 +1,231 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	// Allowed tells whether a token was taken.
+	Allowed bool
+	// Limit is the bucket capacity, the burst.
+	Limit int
+	// Remaining is the number of tokens left on the bucket.
+	Remaining int
+	// RetryAfter is how long until a token is available, zero if Allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Bucket is a token bucket holding up to burst tokens, refilled at rate tokens per second.
+// It's safe for concurrent use.
+type Bucket struct {
+	rate  float64
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	now func() time.Time
+}
+
+// NewBucket returns a full Bucket. It panics if rate or burst are not positive.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate <= 0 || burst <= 0 {
+		panic(fmt.Sprintf("ratelimit: rate and burst must be positive, got rate %v and burst %d", rate, burst))
+	}
+
+	return &Bucket{rate: rate, burst: burst, tokens: float64(burst), now: time.Now}
+}
+
+// Allow takes a token if there is one and reports whether it did.
+func (b *Bucket) Allow() bool {
+	return b.Take().Allowed
+}
+
+// Take takes a token if there is one.
+func (b *Bucket) Take() Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.take(b.now())
+}
+
+// Wait blocks until a token is taken or ctx is done, in which case it returns ctx.Err().
+func (b *Bucket) Wait(ctx context.Context) error {
+	return wait(ctx, b.Take)
+}
+
+func (b *Bucket) take(now time.Time) Result {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	res := Result{Limit: b.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = b.duration(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = b.duration(float64(b.burst) - b.tokens)
+
+	return res
+}
+
+// duration returns how long it takes to refill tokens.
+func (b *Bucket) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / b.rate * float64(time.Second)))
+}
+
+// idle reports whether b has been full since before now - ttl.
+func (b *Bucket) idle(now time.Time, ttl time.Duration) bool {
+	return now.Sub(b.last) >= ttl+b.duration(float64(b.burst)-b.tokens)
+}
+
+// Config configures a Limiter.
+type Config struct {
+	// Rate is the number of tokens per second added to each bucket.
+	Rate float64
+	// Burst is the bucket capacity, defaults to 1.
+	Burst int
+	// IdleTimeout is how long a bucket is kept after being full again, defaults to 10 minutes.
+	// A full bucket holds no state, so evicting it changes nothing for its key.
+	IdleTimeout time.Duration
+	// MaxKeys is the maximum number of buckets held, defaults to 100000. Once reached, the
+	// least recently used bucket is evicted for a new key, even if it's not full.
+	MaxKeys int
+}
+
+// Limiter rate limits by key, each key having its own Bucket. Idle buckets are evicted
+// so memory is bounded by the number of keys seen within Config.IdleTimeout, and by
+// Config.MaxKeys.
+// It's safe for concurrent use, by HTTP middlewares as well as by workers, see Wait.
+type Limiter struct {
+	cfg Config
+
+	mu        sync.Mutex
+	buckets   map[string]*list.Element
+	lru       *list.List // of *keyBucket, the most recently used first
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// New returns a Limiter. It panics if cfg.Rate is not positive.
+func New(cfg Config) *Limiter {
+	if cfg.Rate <= 0 {
+		panic(fmt.Sprintf("ratelimit: rate must be positive, got %v", cfg.Rate))
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 10 * time.Minute
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = 100000
+	}
+
+	return &Limiter{cfg: cfg, buckets: map[string]*list.Element{}, lru: list.New(), now: time.Now}
+}
+
+type keyBucket struct {
+	key    string
+	bucket *Bucket
+}
+
+// Allow takes a token from key's bucket if there is one and reports whether it did.
+func (l *Limiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take takes a token from key's bucket if there is one.
+func (l *Limiter) Take(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.cfg.IdleTimeout {
+		l.sweep(now)
+	}
+
+	el, ok := l.buckets[key]
+	if ok {
+		l.lru.MoveToFront(el)
+	} else {
+		if len(l.buckets) >= l.cfg.MaxKeys {
+			l.remove(l.lru.Back())
+		}
+		el = l.lru.PushFront(&keyBucket{key: key, bucket: NewBucket(l.cfg.Rate, l.cfg.Burst)})
+		l.buckets[key] = el
+	}
+
+	// buckets are only used while holding l.mu, no need to lock them
+	return el.Value.(*keyBucket).bucket.take(now)
+}
+
+// Reset refills key's bucket, e.g. to forget the failed attempts of a client once it succeeds.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a full bucket holds no state
+	if el, ok := l.buckets[key]; ok {
+		l.remove(el)
+	}
+}
+
+// Wait blocks until a token is taken from key's bucket or ctx is done, in which case it
+// returns ctx.Err(). Use it to throttle workers, e.g. calls to an external API.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return wait(ctx, func() Result { return l.Take(key) })
+}
+
+// Len returns the number of buckets held by l.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for _, el := range l.buckets {
+		if el.Value.(*keyBucket).bucket.idle(now, l.cfg.IdleTimeout) {
+			l.remove(el)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) remove(el *list.Element) {
+	l.lru.Remove(el)
+	delete(l.buckets, el.Value.(*keyBucket).key)
+}
+
+func wait(ctx context.Context, take func() Result) error {
+	for {
+		res := take()
+		if res.Allowed {
+			return nil
+		}
+
+		t := time.NewTimer(res.RetryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
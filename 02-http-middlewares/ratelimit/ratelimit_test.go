@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a fake clock for the tests.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestBucketTake(t *testing.T) {
+	c := &clock{t: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	b := NewBucket(2, 3)
+	b.now = c.now
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		want    Result
+	}{
+		{name: "1st", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+		{name: "2nd", want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second}},
+		{name: "3rd", want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+		{name: "empty", want: Result{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 1500 * time.Millisecond}},
+		{name: "half refilled", advance: 250 * time.Millisecond, want: Result{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: 250 * time.Millisecond, Reset: 1250 * time.Millisecond}},
+		{name: "refilled", advance: 250 * time.Millisecond, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+		{name: "never above burst", advance: time.Hour, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+	}
+
+	for _, s := range steps {
+		c.advance(s.advance)
+		if got := b.Take(); got != s.want {
+			t.Errorf("%s: want: %+v, got: %+v", s.name, s.want, got)
+		}
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := New(Config{Rate: 1, Burst: 1})
+
+	if !l.Allow("a") {
+		t.Error("want first request from a allowed")
+	}
+	if l.Allow("a") {
+		t.Error("want second request from a rejected")
+	}
+	if !l.Allow("b") {
+		t.Error("want first request from b allowed, keys must not share buckets")
+	}
+	if got := l.Len(); got != 2 {
+		t.Errorf("want 2 buckets, got: %d", got)
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	c := &clock{t: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(Config{Rate: 1, Burst: 10, IdleTimeout: time.Minute})
+	l.now = c.now
+
+	l.Take("a")
+	c.advance(30 * time.Second)
+	l.Take("b")
+
+	// a has been full for 59s, b is not idle yet
+	c.advance(30 * time.Second)
+	l.Take("c")
+	if got := l.Len(); got != 3 {
+		t.Errorf("want 3 buckets, got: %d", got)
+	}
+
+	// the next sweep, a minute after the last one, evicts a and b
+	c.advance(time.Minute)
+	l.Take("c")
+	if got := l.Len(); got != 1 {
+		t.Errorf("want 1 bucket, got: %d", got)
+	}
+}
+
+func TestLimiterMaxKeys(t *testing.T) {
+	l := New(Config{Rate: 0.01, Burst: 1, MaxKeys: 2})
+
+	l.Take("a")
+	l.Take("b")
+	l.Take("a")
+	// b is the least recently used
+	l.Take("c")
+
+	if got := l.Len(); got != 2 {
+		t.Errorf("want 2 buckets, got: %d", got)
+	}
+	if l.Allow("a") {
+		t.Error("want a kept and rejected")
+	}
+	if !l.Allow("b") {
+		t.Error("want b evicted and allowed again")
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := New(Config{Rate: 100, Burst: 1})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), "worker"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("want Wait to throttle to 100/s, 3 calls took: %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = New(Config{Rate: 0.001, Burst: 1})
+	l.Take("worker")
+	if err := l.Wait(ctx, "worker"); err != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	l := New(Config{Rate: 0.001, Burst: 2})
+
+	l.Take("a")
+	l.Take("a")
+	if l.Allow("a") {
+		t.Fatal("want a rejected once its bucket is empty")
+	}
+
+	l.Reset("a")
+	if got, want := l.Take("a"), 1; !got.Allowed || got.Remaining != want {
+		t.Errorf("want a allowed with %d remaining after the reset, got: %+v", want, got)
+	}
+}
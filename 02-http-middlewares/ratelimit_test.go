@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 0.5, Burst: 2})
+	h := RateLimit(l, KeyByPrincipal)(noop)
+
+	tcs := []struct {
+		name           string
+		principal      string
+		apiKey         string
+		remoteAddr     string
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter string
+	}{
+		{name: "1st", principal: "ci", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "2nd", principal: "ci", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "limited", principal: "ci", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetryAfter: "2"},
+		{name: "other principal", principal: "cd", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "anonymous falls back to IP", remoteAddr: "192.0.2.7:1234", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "same IP other port", remoteAddr: "192.0.2.7:4321", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "unauthenticated API key ignored", apiKey: "key-3", remoteAddr: "192.0.2.7:1234", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetryAfter: "2"},
+	}
+
+	for _, tc := range tcs {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+		if tc.principal != "" {
+			r = r.WithContext(auth.ContextWithPrincipal(r.Context(), auth.Principal{ID: tc.principal}))
+		}
+		if tc.apiKey != "" {
+			r.Header.Set(auth.APIKeyHeader, tc.apiKey)
+		}
+		if tc.remoteAddr != "" {
+			r.RemoteAddr = tc.remoteAddr
+		}
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+
+		if w.Code != tc.wantStatus {
+			t.Errorf("%s: want status: %d, got: %d", tc.name, tc.wantStatus, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("%s: want RateLimit-Limit: 2, got: %q", tc.name, got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != tc.wantRemaining {
+			t.Errorf("%s: want RateLimit-Remaining: %q, got: %q", tc.name, tc.wantRemaining, got)
+		}
+		if got := w.Header().Get("RateLimit-Reset"); got == "" || got == "0" {
+			t.Errorf("%s: want RateLimit-Reset, got: %q", tc.name, got)
+		}
+		if got := w.Header().Get("Retry-After"); got != tc.wantRetryAfter {
+			t.Errorf("%s: want Retry-After: %q, got: %q", tc.name, tc.wantRetryAfter, got)
+		}
+	}
+}
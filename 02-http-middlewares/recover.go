@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
+)
+
+// PanicHook is called by Recover for every recovered panic, e.g. to count or report them.
+// v is the value passed to panic and stack the stack trace of the goroutine which panicked.
+type PanicHook func(r *http.Request, v interface{}, stack []byte)
+
+// RecoverConfig configures the middleware returned by RecoverWith.
+type RecoverConfig struct {
+	// Logger the panics are logged to, e.g. config.Logger().
+	Logger zerolog.Logger
+	// OnPanic is called after the panic is logged, it's optional.
+	OnPanic PanicHook
+}
+
+// Recover is RecoverWith using logger and no hook.
+func Recover(logger zerolog.Logger) func(next http.Handler) http.Handler {
+	return RecoverWith(RecoverConfig{Logger: logger})
+}
+
+// RecoverWith returns a middleware which recovers from panics on the next handler. The panic is
+// logged with its stack trace and the tracking id, then cfg.OnPanic is called. If the response
+// headers were not sent yet, a 500 Internal Server Error JSON body is sent, otherwise there is
+// nothing left to do but let the response be cut short.
+//
+// http.ErrAbortHandler is panicked again, so the http.Server aborts the response as expected.
+func RecoverWith(cfg RecoverConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw, ww := newResponseWriter(w)
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				stack := debug.Stack()
+				headersSent := rw.wroteHeader || rw.hijacked
+
+				cfg.Logger.Error().
+					Str("tracking_id", tracking.IdFromContext(r.Context())).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Str("panic", fmt.Sprint(v)).
+					Bytes("stack", stack).
+					Bool("headers_sent", headersSent).
+					Msg("recovered from panic")
+
+				if cfg.OnPanic != nil {
+					cfg.OnPanic(r, v, stack)
+				}
+
+				if !headersSent {
+					// the headers describing the response the handler meant to send do not
+					// describe the error
+					h := w.Header()
+					h.Del("Content-Length")
+					h.Del("Content-Encoding")
+					h.Del("ETag")
+					tracking.WriteJSONError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
+)
+
+func TestRecover(t *testing.T) {
+	tcs := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantPanic  bool
+	}{
+		{
+			name:       "no panic",
+			handler:    func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) },
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "panic before writing",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"Internal Server Error","tracking_id":"some-id"}` + "\n",
+			wantPanic:  true,
+		},
+		{
+			name: "panic after writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte("partial"))
+				panic("boom")
+			},
+			wantStatus: http.StatusAccepted,
+			wantBody:   "partial",
+			wantPanic:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/users", nil)
+			r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+			w := httptest.NewRecorder()
+
+			buff := &bytes.Buffer{}
+			var hookValue interface{}
+			h := RecoverWith(RecoverConfig{
+				Logger: zerolog.New(buff),
+				OnPanic: func(r *http.Request, v interface{}, stack []byte) {
+					hookValue = v
+				},
+			})(tc.handler)
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tc.wantBody {
+				t.Errorf("want body: %q, got: %q", tc.wantBody, got)
+			}
+
+			if !tc.wantPanic {
+				if buff.Len() != 0 {
+					t.Errorf("want no logs, got: %s", buff)
+				}
+				if hookValue != nil {
+					t.Errorf("want hook not called, got: %v", hookValue)
+				}
+				return
+			}
+
+			if hookValue != "boom" {
+				t.Errorf("want hook called with: boom, got: %v", hookValue)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buff.Bytes(), &got); err != nil {
+				t.Fatalf("invalid log line %q: %v", buff, err)
+			}
+			if got["tracking_id"] != "some-id" {
+				t.Errorf("want tracking_id: some-id, got: %v", got["tracking_id"])
+			}
+			if got["panic"] != "boom" {
+				t.Errorf("want panic: boom, got: %v", got["panic"])
+			}
+			if stack, _ := got["stack"].(string); !strings.Contains(stack, "runtime/debug.Stack") {
+				t.Errorf("want the stack trace logged, got: %q", stack)
+			}
+		})
+	}
+}
+
+func TestRecoverDropsResponseHeaders(t *testing.T) {
+	h := Recover(zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "42")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("X-Custom", "kept")
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("want status: %d, got: %d", http.StatusInternalServerError, w.Code)
+	}
+	for _, k := range []string{"Content-Length", "Content-Encoding", "ETag"} {
+		if got := w.Header().Get(k); got != "" {
+			t.Errorf("want %s removed, got: %q", k, got)
+		}
+	}
+	if got := w.Header().Get("X-Custom"); got != "kept" {
+		t.Errorf("want X-Custom: kept, got: %q", got)
+	}
+}
+
+func TestRecoverErrAbortHandler(t *testing.T) {
+	h := Recover(zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("want panic: %v, got: %v", http.ErrAbortHandler, v)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("expected http.ErrAbortHandler to be panicked again")
+}
@@ -0,0 +1,486 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/cache"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+	"github.com/rs/zerolog"
+)
+
+// ResponseCacheConfig configures a ResponseCache.
+type ResponseCacheConfig struct {
+	// MaxBytes is the maximum size of the cached responses, bodies and headers, defaults to 64MB.
+	MaxBytes int64
+	// Vary are the request headers the responses vary on, e.g. Accept or Accept-Encoding if it's
+	// used inside Compress. Responses varying on other headers are not cached.
+	Vary []string
+	// DefaultTTL is how long responses without a max-age, or s-maxage, are fresh for.
+	// Defaults to 0, they are not cached.
+	DefaultTTL time.Duration
+	// CredentialHeaders are the request headers carrying credentials, besides Authorization and
+	// Cookie. Unauthenticated requests with any of them skip the cache, see ResponseCache.
+	// Defaults to auth.APIKeyHeader and the auth.HMACSigned key id and signature headers.
+	CredentialHeaders []string
+	// Logger the panics of the background revalidations are logged to, e.g. config.Logger().
+	Logger zerolog.Logger
+}
+
+// CacheStats are the ResponseCache statistics.
+type CacheStats struct {
+	// Hits are the requests served from the cache, fresh or stale.
+	Hits uint64
+	// StaleHits are the Hits served stale while the response was revalidated.
+	StaleHits uint64
+	// Misses are the requests served by the next handler.
+	Misses uint64
+	// Collapsed are the Misses which got the response of another, concurrent, request.
+	Collapsed uint64
+	// Entries is the number of cached responses.
+	Entries int
+	// Bytes is the size of the cached responses.
+	Bytes int64
+	// Evictions is the number of responses evicted to make room for others.
+	Evictions uint64
+}
+
+// ResponseCache is an in-memory HTTP cache, shared by all clients, for the GET and HEAD
+// responses. Responses are cached for as long as their Cache-Control s-maxage or max-age say,
+// unless it has no-store, no-cache or private, they set cookies or vary on headers not on
+// ResponseCacheConfig.Vary. Once they expire, they are still served during the
+// stale-while-revalidate period while a new one is fetched in the background.
+//
+// Concurrent misses for the same response are collapsed into a single call to the next
+// handler. It buffers the responses, so streaming handlers do not stream through it, up to
+// ResponseCacheConfig.MaxBytes. Larger responses are not cached, they are streamed to the
+// client once they outgrow it.
+// Requests asking for a range or an upgrade skip the cache.
+//
+// The cache does not authenticate anyone. Inside the auth middleware, e.g.
+// auth.Middleware(a)(c.Handler(next)), the requests are authenticated before a cached response
+// is served, and the responses are cached by auth.Principal, so each one is only served to the
+// principal it was for. Outside it, the requests with credentials, see
+// ResponseCacheConfig.CredentialHeaders, skip the cache, as their responses might be only
+// meant for them.
+type ResponseCache struct {
+	// first, so they are 64-bit aligned for the atomic operations
+	hits, staleHits, misses, collapsed uint64
+
+	cfg ResponseCacheConfig
+	// vary are the canonical ResponseCacheConfig.Vary headers, sorted
+	vary []string
+	// credentials are the canonical headers carrying credentials
+	credentials []string
+	lru         *cache.LRU
+	group       cache.Group
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+
+	now func() time.Time
+}
+
+// NewResponseCache returns an empty ResponseCache.
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 64 << 20
+	}
+
+	c := &ResponseCache{
+		cfg:          cfg,
+		lru:          cache.NewLRU(cfg.MaxBytes),
+		revalidating: map[string]bool{},
+		now:          time.Now,
+	}
+	for _, h := range cfg.Vary {
+		c.vary = append(c.vary, http.CanonicalHeaderKey(h))
+	}
+	sort.Strings(c.vary)
+
+	credentials := cfg.CredentialHeaders
+	if credentials == nil {
+		credentials = []string{auth.APIKeyHeader, auth.HMACKeyIDHeader, auth.HMACSignatureHeader}
+	}
+	c.credentials = []string{"Authorization", "Cookie"}
+	for _, h := range credentials {
+		c.credentials = append(c.credentials, http.CanonicalHeaderKey(h))
+	}
+	return c
+}
+
+// Stats returns the cache statistics.
+func (c *ResponseCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		StaleHits: atomic.LoadUint64(&c.staleHits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Collapsed: atomic.LoadUint64(&c.collapsed),
+		Entries:   c.lru.Len(),
+		Bytes:     c.lru.Bytes(),
+		Evictions: c.lru.Evictions(),
+	}
+}
+
+// Handler returns next wrapped by the cache. Responses served from the cache have an Age
+// header, and all of them an X-Cache header telling whether it was a HIT, a STALE hit or a MISS.
+func (c *ResponseCache) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.cacheableRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.key(r)
+		reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+
+		if _, noCache := reqCC["no-cache"]; !noCache {
+			if v, ok := c.lru.Get(key); ok {
+				e := v.(*cachedResponse)
+				now := c.now()
+				switch {
+				case now.Before(e.expires):
+					atomic.AddUint64(&c.hits, 1)
+					e.write(w, r, "HIT", now)
+					return
+				case now.Before(e.staleUntil):
+					atomic.AddUint64(&c.hits, 1)
+					atomic.AddUint64(&c.staleHits, 1)
+					c.revalidate(next, r, key)
+					e.write(w, r, "STALE", now)
+					return
+				}
+			}
+		}
+
+		atomic.AddUint64(&c.misses, 1)
+		v, err, shared := c.group.Do(key, func() (interface{}, error) {
+			return c.fetch(next, w, r, key), nil
+		})
+		if err != nil {
+			// the request served panicked, serve this one on its own
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := v.(*fetchedResponse)
+		if res.streamed && !shared {
+			// already written to w
+			return
+		}
+		if shared {
+			if !res.cacheable {
+				// it might be meant for the other client only
+				next.ServeHTTP(w, r)
+				return
+			}
+			atomic.AddUint64(&c.collapsed, 1)
+		}
+		res.write(w, r, "MISS", time.Time{})
+	})
+}
+
+// fetchedResponse is a response of the next handler and whether it can be cached. A streamed
+// response was too large to be cached and has been written to the client already.
+type fetchedResponse struct {
+	*cachedResponse
+	cacheable bool
+	streamed  bool
+}
+
+// fetch serves r to next, caching the response if possible. Responses too large to be cached
+// are streamed to w, or discarded if w is nil.
+func (c *ResponseCache) fetch(next http.Handler, w http.ResponseWriter, r *http.Request, key string) *fetchedResponse {
+	rec := &cacheRecorder{w: w, max: c.cfg.MaxBytes, header: http.Header{}}
+	next.ServeHTTP(rec, r)
+	if rec.tooLarge {
+		return &fetchedResponse{streamed: w != nil}
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	now := c.now()
+	e := &cachedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes(), stored: now}
+
+	ttl, swr, ok := c.freshness(rec)
+	if !ok {
+		return &fetchedResponse{cachedResponse: e}
+	}
+
+	e.expires = now.Add(ttl)
+	e.staleUntil = e.expires.Add(swr)
+	c.lru.Add(key, e, e.size(key))
+	return &fetchedResponse{cachedResponse: e, cacheable: true}
+}
+
+// revalidate fetches the response to r again in the background, unless it's being fetched.
+func (c *ResponseCache) revalidate(next http.Handler, r *http.Request, key string) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	// the client request might be done before the revalidation is, keep its values, e.g. the
+	// tracking id or the auth.Principal, but not its cancellation
+	bg := r.Clone(context.WithoutCancel(r.Context()))
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+
+			if v := recover(); v != nil {
+				c.cfg.Logger.Error().
+					Str("tracking_id", tracking.IdFromContext(bg.Context())).
+					Interface("panic", v).
+					Str("key", key).
+					Msg("panic revalidating cached response")
+			}
+		}()
+
+		_, _, _ = c.group.Do(key, func() (interface{}, error) {
+			return c.fetch(next, nil, bg, key), nil
+		})
+	}()
+}
+
+// cacheableRequest reports whether the response to r might be cached.
+func (c *ResponseCache) cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	if _, ok := auth.PrincipalFromContext(r.Context()); !ok {
+		for _, h := range c.credentials {
+			if r.Header.Get(h) != "" {
+				return false
+			}
+		}
+	}
+	_, noStore := parseCacheControl(r.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// key returns the cache key of r: its method, URL, auth.Principal, if any, and the values of the
+// headers it varies on.
+func (c *ResponseCache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.RequestURI())
+
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		b.WriteString("\nprincipal:")
+		b.WriteString(strconv.Quote(p.ID))
+	}
+
+	for _, h := range c.vary {
+		b.WriteByte('\n')
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header[h], ","))
+	}
+	return b.String()
+}
+
+// variesOn reports whether h is one of the ResponseCacheConfig.Vary headers.
+func (c *ResponseCache) variesOn(h string) bool {
+	h = http.CanonicalHeaderKey(h)
+	i := sort.SearchStrings(c.vary, h)
+	return i < len(c.vary) && c.vary[i] == h
+}
+
+// heuristicallyCacheable are the status codes cacheable by default, RFC 7231 section 6.1.
+var heuristicallyCacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// freshness returns for how long the response recorded by rec is fresh, and for how long it
+// can be served stale after that. ok is false if it cannot be cached.
+func (c *ResponseCache) freshness(rec *cacheRecorder) (ttl, swr time.Duration, ok bool) {
+	if !heuristicallyCacheable[rec.status] || len(rec.header["Set-Cookie"]) > 0 {
+		return 0, 0, false
+	}
+
+	for _, v := range rec.header["Vary"] {
+		for _, h := range strings.Split(v, ",") {
+			h = strings.TrimSpace(h)
+			if h == "" {
+				continue
+			}
+			if !c.variesOn(h) {
+				return 0, 0, false
+			}
+		}
+	}
+
+	cc := parseCacheControl(rec.header.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[directive]; ok {
+			return 0, 0, false
+		}
+	}
+
+	ttl = c.cfg.DefaultTTL
+	if v, ok := cc["s-maxage"]; ok {
+		ttl = parseDeltaSeconds(v)
+	} else if v, ok := cc["max-age"]; ok {
+		ttl = parseDeltaSeconds(v)
+	}
+	if ttl <= 0 {
+		return 0, 0, false
+	}
+
+	if v, ok := cc["stale-while-revalidate"]; ok {
+		swr = parseDeltaSeconds(v)
+	}
+	return ttl, swr, true
+}
+
+// parseCacheControl parses a Cache-Control header into its lower case directives and values.
+func parseCacheControl(h string) map[string]string {
+	cc := map[string]string{}
+	for _, part := range strings.Split(h, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+		cc[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return cc
+}
+
+// parseDeltaSeconds parses a delta-seconds value, invalid ones are 0.
+func parseDeltaSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// cachedResponse is a response stored on the cache.
+type cachedResponse struct {
+	status     int
+	header     http.Header
+	body       []byte
+	stored     time.Time
+	expires    time.Time
+	staleUntil time.Time
+}
+
+// size returns an estimate of the memory used by e under key.
+func (e *cachedResponse) size(key string) int64 {
+	n := len(key) + len(e.body)
+	for k, vs := range e.header {
+		n += len(k)
+		for _, v := range vs {
+			n += len(v)
+		}
+	}
+	return int64(n)
+}
+
+// write writes e to w, with an Age header if now is set, and an X-Cache header with xCache.
+func (e *cachedResponse) write(w http.ResponseWriter, r *http.Request, xCache string, now time.Time) {
+	h := w.Header()
+	for k, vs := range e.header {
+		h[k] = append([]string(nil), vs...)
+	}
+	if !now.IsZero() {
+		h.Set("Age", strconv.Itoa(int(now.Sub(e.stored)/time.Second)))
+	}
+	h.Set("X-Cache", xCache)
+
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.body)
+	}
+}
+
+// cacheRecorder records a response to be cached, with a body up to max bytes. Past that the
+// response cannot be cached, so it stops recording and writes the response to w, if set, or
+// discards it.
+type cacheRecorder struct {
+	w      http.ResponseWriter
+	max    int64
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// tooLarge is set once the body grows past max
+	tooLarge bool
+}
+
+func (r *cacheRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *cacheRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 && statusCode >= 200 {
+		r.status = statusCode
+	}
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+
+	if !r.tooLarge {
+		if int64(r.body.Len()+len(b)) <= r.max {
+			return r.body.Write(b)
+		}
+		r.tooLarge = true
+		if r.w != nil {
+			if err := r.startStreaming(); err != nil {
+				return 0, err
+			}
+		}
+		r.body = bytes.Buffer{}
+	}
+
+	if r.w == nil {
+		return len(b), nil
+	}
+	return r.w.Write(b)
+}
+
+// startStreaming writes the recorded header and body to r.w.
+func (r *cacheRecorder) startStreaming() error {
+	h := r.w.Header()
+	for k, vs := range r.header {
+		h[k] = vs
+	}
+	h.Set("X-Cache", "MISS")
+
+	r.w.WriteHeader(r.status)
+	_, err := r.w.Write(r.body.Bytes())
+	return err
+}
@@ -0,0 +1,488 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+)
+
+// cacheClock is a fake clock safe for concurrent use, the revalidations read it in the background.
+type cacheClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *cacheClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *cacheClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newTestCache returns a ResponseCache with a fake clock, serving a handler which counts its
+// calls and answers with the Cache-Control header cc and the body "response <call>".
+func newTestCache(cfg ResponseCacheConfig, cc string) (*ResponseCache, *cacheClock, http.Handler, *int32) {
+	c := NewResponseCache(cfg)
+	clock := &cacheClock{t: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	c.now = clock.now
+
+	var calls int32
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		_, _ = w.Write([]byte("response " + strconv.Itoa(int(n))))
+	}))
+
+	return c, clock, h, &calls
+}
+
+func serveCache(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestResponseCache(t *testing.T) {
+	c, clock, h, calls := newTestCache(ResponseCacheConfig{}, "public, max-age=60")
+
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		wantBody string
+		wantX    string
+		wantAge  string
+	}{
+		{name: "miss", wantBody: "response 1", wantX: "MISS"},
+		{name: "hit", advance: 30 * time.Second, wantBody: "response 1", wantX: "HIT", wantAge: "30"},
+		{name: "expired", advance: 30 * time.Second, wantBody: "response 2", wantX: "MISS"},
+		{name: "hit again", wantBody: "response 2", wantX: "HIT", wantAge: "0"},
+	}
+
+	for _, s := range steps {
+		clock.advance(s.advance)
+		w := serveCache(h, httptest.NewRequest(http.MethodGet, "/users?page=1", nil))
+
+		if got := w.Body.String(); got != s.wantBody {
+			t.Errorf("%s: want body: %q, got: %q", s.name, s.wantBody, got)
+		}
+		if got := w.Header().Get("X-Cache"); got != s.wantX {
+			t.Errorf("%s: want X-Cache: %q, got: %q", s.name, s.wantX, got)
+		}
+		if got := w.Header().Get("Age"); got != s.wantAge {
+			t.Errorf("%s: want Age: %q, got: %q", s.name, s.wantAge, got)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+			t.Errorf("%s: want the Cache-Control kept, got: %q", s.name, got)
+		}
+	}
+
+	// other URLs and methods are cached apart
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/users?page=2", nil))
+	if w := serveCache(h, httptest.NewRequest(http.MethodHead, "/users?page=1", nil)); w.Body.Len() != 0 {
+		t.Errorf("want no body for HEAD, got: %q", w.Body)
+	}
+	if got := atomic.LoadInt32(calls); got != 4 {
+		t.Errorf("want 4 calls to the handler, got: %d", got)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.Entries != 3 || stats.Bytes <= 0 {
+		t.Errorf("want 2 hits, 4 misses and 3 entries, got: %+v", stats)
+	}
+}
+
+func TestResponseCacheNotCached(t *testing.T) {
+	tcs := []struct {
+		name  string
+		cc    string
+		setup func(r *http.Request)
+	}{
+		{name: "no max-age", cc: "public"},
+		{name: "no-store", cc: "no-store, max-age=60"},
+		{name: "no-cache", cc: "no-cache, max-age=60"},
+		{name: "private", cc: "private, max-age=60"},
+		{name: "invalid max-age", cc: "max-age=soon"},
+		{name: "request no-store", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set("Cache-Control", "no-store") }},
+		{name: "request no-cache", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set("Cache-Control", "no-cache") }},
+		{name: "authorization", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer x") }},
+		{name: "cookie", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set("Cookie", "session=x") }},
+		{name: "api key", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, "x") }},
+		{name: "hmac signature", cc: "max-age=60", setup: func(r *http.Request) { r.Header.Set(auth.HMACSignatureHeader, "x") }},
+		{name: "POST", cc: "max-age=60", setup: func(r *http.Request) { r.Method = http.MethodPost }},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, h, calls := newTestCache(ResponseCacheConfig{}, tc.cc)
+
+			for i := 0; i < 2; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tc.setup != nil {
+					tc.setup(r)
+				}
+				serveCache(h, r)
+			}
+
+			if got := atomic.LoadInt32(calls); got != 2 {
+				t.Errorf("want the response not cached, got %d calls", got)
+			}
+		})
+	}
+}
+
+func TestResponseCacheCredentialHeaders(t *testing.T) {
+	_, _, h, calls := newTestCache(ResponseCacheConfig{CredentialHeaders: []string{"x-session"}}, "max-age=60")
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Session", "x")
+		serveCache(h, r)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("want the response not cached, got %d calls", got)
+	}
+
+	// the configured headers replace the defaults
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(auth.APIKeyHeader, "x")
+		serveCache(h, r)
+	}
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Errorf("want the response cached, got %d calls", got)
+	}
+}
+
+// TestResponseCacheInsideAuth checks the cache placement documented on ResponseCache: inside
+// the auth middleware, a cached response is only served to authenticated requests.
+func TestResponseCacheInsideAuth(t *testing.T) {
+	// trusts the internal network, so its requests carry no credentials and are cached
+	internal := auth.AuthenticatorFunc(func(r *http.Request) (auth.Principal, error) {
+		if strings.HasPrefix(r.RemoteAddr, "10.") {
+			return auth.Principal{ID: "internal"}, nil
+		}
+		return auth.Principal{}, auth.ErrNoCredentials
+	})
+	_, _, cached, calls := newTestCache(ResponseCacheConfig{}, "public, max-age=60")
+	h := auth.Middleware(internal)(cached)
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		return serveCache(h, r)
+	}
+
+	get("10.0.0.1:1234")
+	if w := get("10.0.0.2:1234"); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("want X-Cache: HIT, got: %q", w.Header().Get("X-Cache"))
+	}
+
+	w := get("192.0.2.1:1234")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want status: %d, got: %d", http.StatusUnauthorized, w.Code)
+	}
+	if got := w.Header().Get("X-Cache"); got != "" {
+		t.Errorf("want no cached response, got X-Cache: %q", got)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("want 1 call, got: %d", got)
+	}
+}
+
+func TestResponseCacheByPrincipal(t *testing.T) {
+	apiKeys := auth.AuthenticatorFunc(func(r *http.Request) (auth.Principal, error) {
+		if key := r.Header.Get(auth.APIKeyHeader); key != "" {
+			return auth.Principal{ID: key}, nil
+		}
+		return auth.Principal{}, auth.ErrNoCredentials
+	})
+	_, _, cached, calls := newTestCache(ResponseCacheConfig{}, "max-age=60")
+	h := auth.Middleware(apiKeys)(cached)
+
+	tcs := []struct {
+		principal string
+		wantCache string
+		wantBody  string
+	}{
+		{principal: "a", wantCache: "MISS", wantBody: "response 1"},
+		{principal: "a", wantCache: "HIT", wantBody: "response 1"},
+		{principal: "b", wantCache: "MISS", wantBody: "response 2"},
+		{principal: "b", wantCache: "HIT", wantBody: "response 2"},
+	}
+
+	for _, tc := range tcs {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(auth.APIKeyHeader, tc.principal)
+		w := serveCache(h, r)
+
+		if got := w.Header().Get("X-Cache"); got != tc.wantCache || w.Body.String() != tc.wantBody {
+			t.Errorf("%s: want %s %q, got: %s %q", tc.principal, tc.wantCache, tc.wantBody, got, w.Body)
+		}
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("want 2 calls, got: %d", got)
+	}
+}
+
+func TestResponseCacheResponseHeaders(t *testing.T) {
+	tcs := []struct {
+		name       string
+		cfg        ResponseCacheConfig
+		header     http.Header
+		wantCached bool
+	}{
+		{name: "DefaultTTL", cfg: ResponseCacheConfig{DefaultTTL: time.Minute}, wantCached: true},
+		{name: "s-maxage", header: http.Header{"Cache-Control": {"max-age=0, s-maxage=60"}}, wantCached: true},
+		{name: "set cookie", cfg: ResponseCacheConfig{DefaultTTL: time.Minute}, header: http.Header{"Set-Cookie": {"session=x"}}},
+		{name: "not found", cfg: ResponseCacheConfig{DefaultTTL: time.Minute}, header: http.Header{"Status": {"404"}}, wantCached: true},
+		{name: "server error", cfg: ResponseCacheConfig{DefaultTTL: time.Minute}, header: http.Header{"Status": {"500"}}},
+		{
+			name:       "varies on a configured header",
+			cfg:        ResponseCacheConfig{DefaultTTL: time.Minute, Vary: []string{"accept"}},
+			header:     http.Header{"Vary": {"Accept"}},
+			wantCached: true,
+		},
+		{name: "varies on another header", cfg: ResponseCacheConfig{DefaultTTL: time.Minute}, header: http.Header{"Vary": {"Accept"}}},
+		{name: "varies on anything", cfg: ResponseCacheConfig{DefaultTTL: time.Minute, Vary: []string{"Accept"}}, header: http.Header{"Vary": {"*"}}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			h := NewResponseCache(tc.cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				status := http.StatusOK
+				for k, vs := range tc.header {
+					if k == "Status" {
+						status, _ = strconv.Atoi(vs[0])
+						continue
+					}
+					w.Header()[k] = vs
+				}
+				w.WriteHeader(status)
+			}))
+
+			serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+			serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if cached := calls == 1; cached != tc.wantCached {
+				t.Errorf("want cached: %t, got %d calls", tc.wantCached, calls)
+			}
+		})
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	_, _, h, calls := newTestCache(ResponseCacheConfig{Vary: []string{"Accept"}}, "max-age=60")
+
+	get := func(accept string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		return serveCache(h, r).Body.String()
+	}
+
+	json, text := get("application/json"), get("text/plain")
+	if json == text {
+		t.Errorf("want different responses per Accept, got %q for both", json)
+	}
+	if got := get("application/json"); got != json {
+		t.Errorf("want: %q, got: %q", json, got)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("want 2 calls, got: %d", got)
+	}
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	c, clock, h, calls := newTestCache(ResponseCacheConfig{}, "max-age=60, stale-while-revalidate=30")
+
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	clock.advance(70 * time.Second)
+
+	w := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("X-Cache"); got != "STALE" || w.Body.String() != "response 1" {
+		t.Fatalf("want the stale response 1, got: %s %q", got, w.Body)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(calls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("want the response revalidated in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// the revalidation stores the response after the handler returns
+	for {
+		w = serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Header().Get("X-Cache") == "HIT" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if w.Body.String() != "response 2" {
+		t.Errorf("want the revalidated response 2, got: %s %q", w.Header().Get("X-Cache"), w.Body)
+	}
+
+	clock.advance(100 * time.Second)
+	if got := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil)).Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("want a miss once too stale, got: %q", got)
+	}
+	if stats := c.Stats(); stats.StaleHits < 1 {
+		t.Errorf("want stale hits counted, got: %+v", stats)
+	}
+}
+
+func TestResponseCacheRevalidationContext(t *testing.T) {
+	c := NewResponseCache(ResponseCacheConfig{})
+	clock := &cacheClock{t: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	c.now = clock.now
+
+	type ctxKey struct{}
+	canceled, revalidated := make(chan struct{}), make(chan context.Context, 1)
+	var calls int32
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			<-canceled
+			revalidated <- r.Context()
+		}
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=30")
+	}))
+
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	clock.advance(70 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	cancel()
+	close(canceled)
+
+	select {
+	case ctx := <-revalidated:
+		if got := ctx.Value(ctxKey{}); got != "value" {
+			t.Errorf("want the request values kept, got: %v", got)
+		}
+		if err := ctx.Err(); err != nil {
+			t.Errorf("want the revalidation not canceled with the request, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the response revalidated in the background")
+	}
+}
+
+func TestResponseCacheCollapsesMisses(t *testing.T) {
+	for _, cc := range []string{"max-age=60", "private"} {
+		t.Run(cc, func(t *testing.T) {
+			c := NewResponseCache(ResponseCacheConfig{})
+
+			var calls int32
+			started, release := make(chan struct{}), make(chan struct{})
+			h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					close(started)
+					<-release
+				}
+				w.Header().Set("Cache-Control", cc)
+				_, _ = w.Write([]byte("users"))
+			}))
+
+			const n = 10
+			var wg sync.WaitGroup
+			bodies := make(chan string, n)
+			wg.Add(n)
+			for i := 0; i < n; i++ {
+				go func() {
+					defer wg.Done()
+					bodies <- serveCache(h, httptest.NewRequest(http.MethodGet, "/users", nil)).Body.String()
+				}()
+				if i == 0 {
+					<-started
+				}
+			}
+			// let the others wait on the first request
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(bodies)
+
+			for b := range bodies {
+				if b != "users" {
+					t.Errorf("want: users, got: %q", b)
+				}
+			}
+
+			stats := c.Stats()
+			if cc == "private" {
+				// private responses are not shared, the others call the handler themselves
+				if calls != n || stats.Collapsed != 0 {
+					t.Errorf("want %d calls and none collapsed, got %d calls and %+v", n, calls, stats)
+				}
+				return
+			}
+			if calls != 1 || stats.Collapsed != n-1 || stats.Misses != n {
+				t.Errorf("want 1 call and %d collapsed, got %d calls and %+v", n-1, calls, stats)
+			}
+		})
+	}
+}
+
+func TestResponseCacheMaxBytes(t *testing.T) {
+	c, _, h, _ := newTestCache(ResponseCacheConfig{MaxBytes: 200}, "max-age=60")
+
+	for i := 0; i < 10; i++ {
+		serveCache(h, httptest.NewRequest(http.MethodGet, "/users/"+strings.Repeat("x", i), nil))
+	}
+
+	stats := c.Stats()
+	if stats.Bytes > 200 || stats.Evictions == 0 || stats.Entries == 0 {
+		t.Errorf("want at most 200 bytes cached and evictions, got: %+v", stats)
+	}
+}
+
+func TestResponseCacheStreamsLargeResponses(t *testing.T) {
+	c := NewResponseCache(ResponseCacheConfig{MaxBytes: 100})
+	chunk := strings.Repeat("x", 60)
+
+	var calls int32
+	client := httptest.NewRecorder()
+	var streamed int
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(chunk))
+		_, _ = w.Write([]byte(chunk))
+		streamed = client.Body.Len()
+		_, _ = w.Write([]byte(chunk))
+	}))
+
+	h.ServeHTTP(client, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if streamed != 2*len(chunk) {
+		t.Errorf("want the response streamed once too large, got %d bytes before the handler returned", streamed)
+	}
+	if client.Code != http.StatusOK || client.Body.String() != strings.Repeat(chunk, 3) {
+		t.Errorf("want the whole response, got: %d %q", client.Code, client.Body)
+	}
+	if got := client.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("want X-Cache: MISS, got: %q", got)
+	}
+
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("want the response not cached, got %d calls", got)
+	}
+}
@@ -0,0 +1,258 @@
+package middlewares
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter records the status code and the number of bytes written to a http.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	bytes       int64
+	wroteHeader bool
+	hijacked    bool
+}
+
+// newResponseWriter wraps w with a responseWriter. The returned http.ResponseWriter implements
+// http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom if, and only if, w does.
+func newResponseWriter(w http.ResponseWriter) (*responseWriter, http.ResponseWriter) {
+	rw := &responseWriter{ResponseWriter: w}
+	return rw, wrapOptionalInterfaces(w, rw)
+}
+
+// Status returns the response status code, 200 if the handler wrote nothing and 101 if it
+// hijacked the connection without writing a status.
+func (w *responseWriter) Status() int {
+	switch {
+	case w.wroteHeader:
+		return w.status
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	default:
+		return http.StatusOK
+	}
+}
+
+// BytesWritten returns the number of bytes of the response body written so far.
+func (w *responseWriter) BytesWritten() int64 {
+	return w.bytes
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		// informational responses can be followed by the final one
+		if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+			w.status = statusCode
+			w.wroteHeader = true
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, it's used by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.bytes += n
+	return n, err
+}
+
+// unwrapper is implemented by the http.ResponseWriter wrappers, see http.ResponseController.
+type unwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// optionalWriter is a http.ResponseWriter implementing all the optional interfaces by delegating
+// to the underlying http.ResponseWriter. The optional methods must only be called if the
+// underlying http.ResponseWriter implements them.
+type optionalWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.ReaderFrom
+	unwrapper
+}
+
+// wrapOptionalInterfaces returns a http.ResponseWriter backed by ow which implements the same
+// optional interfaces w does, so type assertions on it tell the truth. It always implements
+// Unwrap, so http.ResponseController reaches w for the methods it does not implement.
+func wrapOptionalInterfaces(w http.ResponseWriter, ow optionalWriter) http.ResponseWriter {
+	const (
+		flusher = 1 << iota
+		hijacker
+		pusher
+		readerFrom
+	)
+
+	var mask int
+	if _, ok := w.(http.Flusher); ok {
+		mask |= flusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		mask |= hijacker
+	}
+	if _, ok := w.(http.Pusher); ok {
+		mask |= pusher
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		mask |= readerFrom
+	}
+
+	type (
+		F  = http.Flusher
+		H  = http.Hijacker
+		P  = http.Pusher
+		RF = io.ReaderFrom
+		RW = http.ResponseWriter
+		U  = unwrapper
+	)
+
+	switch mask {
+	case flusher:
+		return struct {
+			RW
+			U
+			F
+		}{ow, ow, ow}
+	case hijacker:
+		return struct {
+			RW
+			U
+			H
+		}{ow, ow, ow}
+	case pusher:
+		return struct {
+			RW
+			U
+			P
+		}{ow, ow, ow}
+	case readerFrom:
+		return struct {
+			RW
+			U
+			RF
+		}{ow, ow, ow}
+	case flusher | hijacker:
+		return struct {
+			RW
+			U
+			F
+			H
+		}{ow, ow, ow, ow}
+	case flusher | pusher:
+		return struct {
+			RW
+			U
+			F
+			P
+		}{ow, ow, ow, ow}
+	case flusher | readerFrom:
+		return struct {
+			RW
+			U
+			F
+			RF
+		}{ow, ow, ow, ow}
+	case hijacker | pusher:
+		return struct {
+			RW
+			U
+			H
+			P
+		}{ow, ow, ow, ow}
+	case hijacker | readerFrom:
+		return struct {
+			RW
+			U
+			H
+			RF
+		}{ow, ow, ow, ow}
+	case pusher | readerFrom:
+		return struct {
+			RW
+			U
+			P
+			RF
+		}{ow, ow, ow, ow}
+	case flusher | hijacker | pusher:
+		return struct {
+			RW
+			U
+			F
+			H
+			P
+		}{ow, ow, ow, ow, ow}
+	case flusher | hijacker | readerFrom:
+		return struct {
+			RW
+			U
+			F
+			H
+			RF
+		}{ow, ow, ow, ow, ow}
+	case flusher | pusher | readerFrom:
+		return struct {
+			RW
+			U
+			F
+			P
+			RF
+		}{ow, ow, ow, ow, ow}
+	case hijacker | pusher | readerFrom:
+		return struct {
+			RW
+			U
+			H
+			P
+			RF
+		}{ow, ow, ow, ow, ow}
+	case flusher | hijacker | pusher | readerFrom:
+		return ow
+	default:
+		return struct {
+			RW
+			U
+		}{ow, ow}
+	}
+}
@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullWriter implements all the optional http.ResponseWriter interfaces.
+type fullWriter struct {
+	*httptest.ResponseRecorder
+
+	hijacked   bool
+	pushed     string
+	readFromed bool
+}
+
+func (w *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func (w *fullWriter) Push(target string, _ *http.PushOptions) error {
+	w.pushed = target
+	return nil
+}
+
+func (w *fullWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFromed = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+// plainWriter implements none of the optional interfaces.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	tcs := []struct {
+		name string
+		w    http.ResponseWriter
+		want bool
+	}{
+		{name: "all", w: &fullWriter{ResponseRecorder: httptest.NewRecorder()}, want: true},
+		{name: "none", w: plainWriter{httptest.NewRecorder()}, want: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, w := newResponseWriter(tc.w)
+
+			if _, ok := w.(http.Flusher); ok != tc.want {
+				t.Errorf("want http.Flusher: %t, got: %t", tc.want, ok)
+			}
+			if _, ok := w.(http.Hijacker); ok != tc.want {
+				t.Errorf("want http.Hijacker: %t, got: %t", tc.want, ok)
+			}
+			if _, ok := w.(http.Pusher); ok != tc.want {
+				t.Errorf("want http.Pusher: %t, got: %t", tc.want, ok)
+			}
+			if _, ok := w.(io.ReaderFrom); ok != tc.want {
+				t.Errorf("want io.ReaderFrom: %t, got: %t", tc.want, ok)
+			}
+		})
+	}
+}
+
+func TestResponseWriterOnlyFlusher(t *testing.T) {
+	// httptest.ResponseRecorder implements only http.Flusher
+	_, w := newResponseWriter(httptest.NewRecorder())
+
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("expected http.Flusher")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		t.Error("expected no http.Hijacker")
+	}
+}
+
+func TestResponseWriterDelegates(t *testing.T) {
+	fw := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+	rw, w := newResponseWriter(fw)
+
+	if err := w.(http.Pusher).Push("/style.css", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.(http.Flusher).Flush()
+
+	if fw.pushed != "/style.css" {
+		t.Errorf("want pushed: /style.css, got: %s", fw.pushed)
+	}
+	if !fw.readFromed || n != 5 || rw.BytesWritten() != 5 {
+		t.Errorf("want 5 bytes written through ReadFrom, got: %d, %d", n, rw.BytesWritten())
+	}
+	if !fw.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+	if rw.Status() != http.StatusOK {
+		t.Errorf("want status: %d, got: %d", http.StatusOK, rw.Status())
+	}
+
+	if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fw.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+}
+
+// deadlineWriter is a http.Flusher supporting write deadlines, as the http.Server writers.
+type deadlineWriter struct {
+	*httptest.ResponseRecorder
+
+	deadline time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestResponseWriterResponseController(t *testing.T) {
+	dw := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	_, w := newResponseWriter(dw)
+
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dw.deadline.IsZero() {
+		t.Error("want the deadline set on the underlying http.ResponseWriter")
+	}
+}
+
+func TestResponseWriterStatus(t *testing.T) {
+	tcs := []struct {
+		name  string
+		write func(w http.ResponseWriter)
+		want  int
+	}{
+		{name: "nothing written", write: func(w http.ResponseWriter) {}, want: http.StatusOK},
+		{name: "write", write: func(w http.ResponseWriter) { _, _ = w.Write([]byte("hi")) }, want: http.StatusOK},
+		{name: "write header", write: func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) }, want: http.StatusNotFound},
+		{
+			name: "informational then final",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+			},
+			want: http.StatusCreated,
+		},
+		{
+			name: "second write header is ignored",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusAccepted)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			want: http.StatusAccepted,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rw, w := newResponseWriter(plainWriter{httptest.NewRecorder()})
+			tc.write(w)
+
+			if got := rw.Status(); got != tc.want {
+				t.Errorf("want status: %d, got: %d", tc.want, got)
+			}
+		})
+	}
+}
@@ -6,10 +6,120 @@ import (
 	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
 )
 
+// TrackingIDHeader is the http header the tracking id is read from.
+const TrackingIDHeader = tracking.Header
+
+// InvalidIDPolicy defines what TrackingID does when the incoming tracking id is
+// malformed or too long.
+type InvalidIDPolicy int
+
+const (
+	// ReplaceInvalidID discards the invalid tracking id and generates a new one.
+	ReplaceInvalidID InvalidIDPolicy = iota
+	// RejectInvalidID responds with 400 Bad Request without calling the next handler.
+	RejectInvalidID
+)
+
+// TrackingIDConfig configures the middleware returned by TrackingIDWith.
+type TrackingIDConfig struct {
+	// Header to read the tracking id from, defaults to TrackingIDHeader.
+	Header string
+	// MaxLength is the maximum accepted tracking id length, defaults to tracking.MaxIDLength.
+	MaxLength int
+	// Policy applied to invalid tracking ids, defaults to ReplaceInvalidID.
+	Policy InvalidIDPolicy
+	// Generator used to generate new tracking ids, defaults to tracking.DefaultGenerator.
+	Generator tracking.Generator
+	// ResponseHeader is the response header the tracking id is echoed back on, defaults to Header.
+	ResponseHeader string
+	// DisableResponseHeader disables echoing the tracking id back on the response.
+	DisableResponseHeader bool
+	// Propagators extract the trace context, baggage and tracking id sent by the client,
+	// they are tried in order. Defaults to tracking.DefaultPropagators.
+	Propagators tracking.Propagators
+	// Sampler decides whether the request trace is sampled, defaults to tracking.DefaultSampler.
+	Sampler tracking.Sampler
+}
+
+// TrackingID is TrackingIDWith using the default TrackingIDConfig.
 func TrackingID(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := tracking.ContextWithID(r.Context())
+	return TrackingIDWith(TrackingIDConfig{})(next)
+}
+
+// TrackingIDWith returns a middleware which adds the tracking id sent by the client to the request context.
+// Invalid ids are handled according to cfg.Policy. If no tracking id is sent on cfg.Header, cfg.Propagators
+// are tried, e.g. a tracking.HeaderPropagator for X-Request-ID. If there is still none, the trace-id of the
+// upstream trace is used, so logs line up with the services in front of us, otherwise a new one is generated.
+//
+// The trace context sent by the client is continued, if there is none a new trace is started.
+// Either way cfg.Sampler decides whether the trace is sampled, see tracking.Sampled.
+// The baggage sent by the client is added to the context as well.
+//
+// The tracking id is echoed back on cfg.ResponseHeader, so clients have it to report errors.
+// Use tracking.WriteJSONError to add it to error bodies as well.
+func TrackingIDWith(cfg TrackingIDConfig) func(next http.Handler) http.Handler {
+	if cfg.Header == "" {
+		cfg.Header = TrackingIDHeader
+	}
+	if cfg.Generator == nil {
+		cfg.Generator = tracking.DefaultGenerator
+	}
+	if cfg.ResponseHeader == "" {
+		cfg.ResponseHeader = cfg.Header
+	}
+	if cfg.Propagators == nil {
+		cfg.Propagators = tracking.DefaultPropagators()
+	}
+	if cfg.Sampler == nil {
+		cfg.Sampler = tracking.DefaultSampler
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if id := r.Header.Get(cfg.Header); id != "" {
+				if err := tracking.ValidateID(id, cfg.MaxLength); err == nil {
+					ctx = tracking.ContextWithExistingID(ctx, id)
+				} else if cfg.Policy == RejectInvalidID {
+					tracking.WriteJSONError(w, r, http.StatusBadRequest, "invalid "+cfg.Header+" header: "+err.Error())
+					return
+				}
+			}
+
+			ctx, _ = cfg.Propagators.Extract(ctx, r.Header)
+
+			tc, upstream := tracking.TraceFromContext(ctx)
+			if !upstream {
+				var err error
+				if tc, err = tracking.NewTraceContext(); err != nil {
+					tracking.WriteJSONError(w, r, http.StatusInternalServerError, "could not start a trace: "+err.Error())
+					return
+				}
+				ctx = tracking.ContextWithTrace(ctx, tc)
+			}
+			ctx = tracking.ContextWithSamplingDecision(ctx, cfg.Sampler, upstream)
+
+			if tracking.IdFromContext(ctx) == "" {
+				if upstream {
+					ctx = tracking.ContextWithExistingID(ctx, tc.TraceID.String())
+				} else {
+					var err error
+					if ctx, err = tracking.ContextWithGeneratedID(ctx, cfg.Generator); err != nil {
+						tracking.WriteJSONError(w, r, http.StatusInternalServerError, err.Error())
+						return
+					}
+				}
+			}
+
+			if cfg.DisableResponseHeader {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			rw, finish := wrapHeaderWriter(w, cfg.ResponseHeader, tracking.IdFromContext(ctx))
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			finish()
+		})
+	}
 }
@@ -0,0 +1,427 @@
+package solution
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+func TestTrackingID(t *testing.T) {
+	tcs := []struct {
+		name       string
+		cfg        TrackingIDConfig
+		header     string
+		wantStatus int
+		wantCalled bool
+		wantKept   bool
+	}{
+		{
+			name:       "no header generates a new id",
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "valid id is kept",
+			header:     "a-valid_tracking.id:42",
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantKept:   true,
+		},
+		{
+			name:       "malformed id is replaced",
+			cfg:        TrackingIDConfig{Policy: ReplaceInvalidID},
+			header:     "not valid!",
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "oversized id is replaced",
+			cfg:        TrackingIDConfig{Policy: ReplaceInvalidID, MaxLength: 8},
+			header:     "123456789",
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "malformed id is rejected",
+			cfg:        TrackingIDConfig{Policy: RejectInvalidID},
+			header:     "not valid!",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "oversized id is rejected",
+			cfg:        TrackingIDConfig{Policy: RejectInvalidID},
+			header:     strings.Repeat("a", tracking.MaxIDLength+1),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "custom header",
+			cfg:        TrackingIDConfig{Header: "X-Request-ID"},
+			header:     "request-id",
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantKept:   true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			header := tc.cfg.Header
+			if header == "" {
+				header = TrackingIDHeader
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			if tc.header != "" {
+				r.Header.Set(header, tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			var called bool
+			var trackingID string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				trackingID = tracking.IdFromContext(r.Context())
+			})
+
+			TrackingIDWith(tc.cfg)(handler).ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if called != tc.wantCalled {
+				t.Fatalf("want handler called: %t, got: %t", tc.wantCalled, called)
+			}
+			if !called {
+				return
+			}
+
+			if trackingID == "" {
+				t.Error("expected a tracking id, got an empty string")
+			}
+			if tc.wantKept && trackingID != tc.header {
+				t.Errorf("want tracking id: %s, got: %s", tc.header, trackingID)
+			}
+			if !tc.wantKept && trackingID == tc.header {
+				t.Errorf("expected a new tracking id, got the incoming one: %s", trackingID)
+			}
+		})
+	}
+}
+
+func TestTrackingIDContinuesTrace(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set(tracking.TraceParentHeader, "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+
+	var gotTraceID, gotParentID, gotTrackingID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceID = tracking.TraceIDFromContext(r.Context())
+		gotParentID = tracking.ParentIDFromContext(r.Context())
+		gotTrackingID = tracking.IdFromContext(r.Context())
+	})
+
+	TrackingID(handler).ServeHTTP(w, r)
+
+	if gotTraceID != traceID {
+		t.Errorf("want trace-id: %s, got: %s", traceID, gotTraceID)
+	}
+	if want := "00f067aa0ba902b7"; gotParentID != want {
+		t.Errorf("want parent-id: %s, got: %s", want, gotParentID)
+	}
+	if gotTrackingID != traceID {
+		t.Errorf("want tracking id: %s, got: %s", traceID, gotTrackingID)
+	}
+}
+
+func TestTrackingIDStartsTrace(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set(tracking.TraceParentHeader, "invalid")
+	w := httptest.NewRecorder()
+
+	var gotTraceID, gotParentID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceID = tracking.TraceIDFromContext(r.Context())
+		gotParentID = tracking.ParentIDFromContext(r.Context())
+	})
+
+	TrackingID(handler).ServeHTTP(w, r)
+
+	if gotTraceID == "" {
+		t.Error("expected a new trace-id, got an empty string")
+	}
+	if gotParentID != "" {
+		t.Errorf("expected no parent-id, got: %s", gotParentID)
+	}
+}
+
+func TestTrackingIDGenerator(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	w := httptest.NewRecorder()
+
+	var trackingID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trackingID = tracking.IdFromContext(r.Context())
+	})
+
+	g := tracking.GeneratorFunc(func() (string, error) { return "generated", nil })
+	TrackingIDWith(TrackingIDConfig{Generator: g})(handler).ServeHTTP(w, r)
+
+	if want := "generated"; trackingID != want {
+		t.Errorf("want tracking id: %s, got: %s", want, trackingID)
+	}
+}
+
+func TestTrackingIDGeneratorError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	w := httptest.NewRecorder()
+
+	var called bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	g := tracking.GeneratorFunc(func() (string, error) { return "", errors.New("no entropy") })
+	TrackingIDWith(TrackingIDConfig{Generator: g})(handler).ServeHTTP(w, r)
+
+	if called {
+		t.Error("expected the handler not to be called")
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("want status: %d, got: %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestTrackingIDBaggage(t *testing.T) {
+	tcs := []struct {
+		name    string
+		baggage string
+		want    string
+	}{
+		{name: "valid baggage", baggage: "tenant=acme,tier=gold", want: "tenant=acme,tier=gold"},
+		{name: "invalid baggage is dropped", baggage: "tenant", want: ""},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			r.Header.Set(tracking.BaggageHeader, tc.baggage)
+			w := httptest.NewRecorder()
+
+			var got string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = tracking.BaggageFromContext(r.Context()).String()
+			})
+
+			TrackingID(handler).ServeHTTP(w, r)
+
+			if got != tc.want {
+				t.Errorf("want baggage: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTrackingIDResponseHeader(t *testing.T) {
+	tcs := []struct {
+		name    string
+		cfg     TrackingIDConfig
+		handler http.HandlerFunc
+		header  string
+		want    string
+	}{
+		{
+			name:    "echoed on write",
+			handler: func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) },
+			header:  TrackingIDHeader,
+			want:    "some-id",
+		},
+		{
+			name:    "echoed on write header",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			header:  TrackingIDHeader,
+			want:    "some-id",
+		},
+		{
+			name:    "echoed when the handler writes nothing",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			header:  TrackingIDHeader,
+			want:    "some-id",
+		},
+		{
+			name:    "custom response header",
+			cfg:     TrackingIDConfig{ResponseHeader: "X-Request-ID"},
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			header:  "X-Request-ID",
+			want:    "some-id",
+		},
+		{
+			name: "handler value is kept",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(TrackingIDHeader, "from-handler")
+				w.WriteHeader(http.StatusOK)
+			},
+			header: TrackingIDHeader,
+			want:   "from-handler",
+		},
+		{
+			name:    "disabled",
+			cfg:     TrackingIDConfig{DisableResponseHeader: true},
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			header:  TrackingIDHeader,
+			want:    "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(TrackingIDWith(tc.cfg)(tc.handler))
+			defer srv.Close()
+
+			r, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r.Header.Set(TrackingIDHeader, "some-id")
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := resp.Header.Get(tc.header); got != tc.want {
+				t.Errorf("want %s: %q, got: %q", tc.header, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTrackingIDKeepsFlusherAndHijacker(t *testing.T) {
+	var isFlusher, isHijacker bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher = w.(http.Flusher)
+		_, isHijacker = w.(http.Hijacker)
+		w.(http.Flusher).Flush()
+	})
+
+	srv := httptest.NewServer(TrackingID(handler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if !isFlusher {
+		t.Error("expected the response writer to implement http.Flusher")
+	}
+	if !isHijacker {
+		t.Error("expected the response writer to implement http.Hijacker")
+	}
+	if resp.Header.Get(TrackingIDHeader) == "" {
+		t.Errorf("expected %s to be set before flushing", TrackingIDHeader)
+	}
+}
+
+func TestTrackingIDResponseController(t *testing.T) {
+	var err error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	})
+
+	srv := httptest.NewServer(TrackingID(handler))
+	defer srv.Close()
+
+	resp, getErr := http.Get(srv.URL)
+	if getErr != nil {
+		t.Fatalf("unexpected error: %v", getErr)
+	}
+	resp.Body.Close()
+
+	if err != nil {
+		t.Errorf("want the write deadline set through Unwrap, got: %v", err)
+	}
+}
+
+func TestTrackingIDRecorderIsNotHijacker(t *testing.T) {
+	var isHijacker bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isHijacker = w.(http.Hijacker)
+	})
+
+	TrackingID(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if isHijacker {
+		t.Error("expected the response writer not to implement http.Hijacker")
+	}
+}
+
+func TestTrackingIDPropagators(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set(tracking.B3Header, "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1")
+	r.Header.Set("X-Request-ID", "legacy-id")
+	w := httptest.NewRecorder()
+
+	var gotTraceID, gotTrackingID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceID = tracking.TraceIDFromContext(r.Context())
+		gotTrackingID = tracking.IdFromContext(r.Context())
+	})
+
+	cfg := TrackingIDConfig{Propagators: tracking.Propagators{
+		tracking.TraceContextPropagator{},
+		tracking.B3Propagator{},
+		tracking.HeaderPropagator{Header: "X-Request-ID"},
+	}}
+	TrackingIDWith(cfg)(handler).ServeHTTP(w, r)
+
+	if want := "80f198ee56343ba864fe8b2a57d3eff7"; gotTraceID != want {
+		t.Errorf("want trace-id: %s, got: %s", want, gotTraceID)
+	}
+	if want := "legacy-id"; gotTrackingID != want {
+		t.Errorf("want tracking id: %s, got: %s", want, gotTrackingID)
+	}
+}
+
+func TestTrackingIDSampler(t *testing.T) {
+	tcs := []struct {
+		name        string
+		sampler     tracking.Sampler
+		traceparent string
+		want        bool
+	}{
+		{name: "default samples new traces", want: true},
+		{name: "default follows sampled parent", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: true},
+		{name: "default follows not sampled parent", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", want: false},
+		{name: "never sample", sampler: tracking.NeverSample(), want: false},
+		{name: "parent based never sample root", sampler: tracking.ParentBased(tracking.NeverSample()), want: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			if tc.traceparent != "" {
+				r.Header.Set(tracking.TraceParentHeader, tc.traceparent)
+			}
+			w := httptest.NewRecorder()
+
+			var got bool
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = tracking.Sampled(r.Context())
+			})
+
+			TrackingIDWith(TrackingIDConfig{Sampler: tc.sampler})(handler).ServeHTTP(w, r)
+
+			if got != tc.want {
+				t.Errorf("want sampled: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package solution
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// headerWriter sets a header just before the response headers are sent, unless the handler has
+// already set it.
+type headerWriter struct {
+	http.ResponseWriter
+
+	key, value string
+	done       bool
+}
+
+// wrapHeaderWriter returns w wrapped by a headerWriter which still implements http.Flusher and
+// http.Hijacker if w does. Call finish once the handler returns, so the header is set even if
+// the handler did not write anything.
+func wrapHeaderWriter(w http.ResponseWriter, key, value string) (rw http.ResponseWriter, finish func()) {
+	hw := &headerWriter{ResponseWriter: w, key: key, value: value}
+	return hw.wrap(), hw.setHeader
+}
+
+func (w *headerWriter) wrap() http.ResponseWriter {
+	_, isFlusher := w.ResponseWriter.(http.Flusher)
+	_, isHijacker := w.ResponseWriter.(http.Hijacker)
+
+	switch {
+	case isFlusher && isHijacker:
+		return flushHijackHeaderWriter{w}
+	case isFlusher:
+		return flushHeaderWriter{w}
+	case isHijacker:
+		return hijackHeaderWriter{w}
+	default:
+		return w
+	}
+}
+
+func (w *headerWriter) setHeader() {
+	if w.done {
+		return
+	}
+	w.done = true
+
+	if w.Header().Get(w.key) == "" {
+		w.Header().Set(w.key, w.value)
+	}
+}
+
+func (w *headerWriter) WriteHeader(statusCode int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, it's used by http.ResponseController.
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headerWriter) flush() {
+	w.setHeader()
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *headerWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type flushHeaderWriter struct{ *headerWriter }
+
+func (w flushHeaderWriter) Flush() { w.flush() }
+
+type hijackHeaderWriter struct{ *headerWriter }
+
+func (w hijackHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type flushHijackHeaderWriter struct{ *headerWriter }
+
+func (w flushHijackHeaderWriter) Flush() { w.flush() }
+
+func (w flushHijackHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
@@ -0,0 +1,242 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// TimeoutConfig configures the middleware returned by TimeoutWith.
+type TimeoutConfig struct {
+	// Timeout is the default request timeout, see config.Config.TimeoutConfig.
+	// A Timeout <= 0 means no timeout.
+	Timeout time.Duration
+	// Routes overrides Timeout by URL path. A key ending in "/" matches the whole subtree,
+	// like on http.ServeMux, and the longest match wins. A duration <= 0 disables the timeout
+	// for the route, e.g. for long-lived streams.
+	Routes map[string]time.Duration
+	// StatusCode sent on timeout, defaults to 503 Service Unavailable.
+	// Use 504 Gateway Timeout if the handlers mostly wait on upstream services.
+	StatusCode int
+	// Message is the error message sent on timeout, defaults to "request timed out".
+	Message string
+}
+
+// Timeout is TimeoutWith using d as the timeout for all routes.
+func Timeout(d time.Duration) func(next http.Handler) http.Handler {
+	return TimeoutWith(TimeoutConfig{Timeout: d})
+}
+
+// TimeoutWith returns a middleware which adds a deadline to the request context and runs the
+// next handler on its own goroutine. If the deadline passes before the handler returns:
+//   - if the handler has not written anything yet, cfg.StatusCode is sent with a JSON error
+//     body carrying the tracking id, see tracking.WriteJSONError;
+//   - if the response has already started, e.g. a stream, it's aborted with http.ErrAbortHandler,
+//     so the client does not take the truncated response as complete.
+//
+// Either way, anything the handler writes afterwards is dropped and the writes return
+// http.ErrHandlerTimeout. Unlike http.TimeoutHandler the response is not buffered, so
+// handlers can stream and flush.
+//
+// Panics on the handler are propagated to the goroutine serving the request, so Recover
+// still catches them.
+func TimeoutWith(cfg TimeoutConfig) func(next http.Handler) http.Handler {
+	if cfg.StatusCode == 0 {
+		cfg.StatusCode = http.StatusServiceUnavailable
+	}
+	if cfg.Message == "" {
+		cfg.Message = "request timed out"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := cfg.timeoutFor(r.URL.Path)
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			var ww http.ResponseWriter = tw
+			if _, ok := w.(http.Flusher); ok {
+				ww = flushTimeoutWriter{tw}
+			}
+
+			done := make(chan struct{})
+			// whether the handler returned before the deadline, read once done is closed
+			var inTime bool
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						if v != http.ErrAbortHandler {
+							v = handlerPanic{value: v, stack: debug.Stack()}
+						}
+						panicked <- v
+					}
+				}()
+				next.ServeHTTP(ww, r)
+				inTime = ctx.Err() == nil
+				close(done)
+			}()
+
+			select {
+			case v := <-panicked:
+				tw.mu.Lock()
+				tw.timedOut = true
+				tw.mu.Unlock()
+				panic(v)
+			case <-done:
+				tw.finish()
+			case <-ctx.Done():
+				// select picks at random when both are ready, the response of a handler which
+				// returned before the deadline is complete and must not be aborted
+				select {
+				case <-done:
+					if inTime {
+						tw.finish()
+						return
+					}
+				default:
+				}
+
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					// the client is gone, there is no one to answer to
+					return
+				}
+				if tw.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+				tracking.WriteJSONError(w, r, cfg.StatusCode, cfg.Message)
+			}
+		})
+	}
+}
+
+// timeoutFor returns the timeout for path.
+func (cfg TimeoutConfig) timeoutFor(path string) time.Duration {
+	d, ok := cfg.Routes[path]
+	if ok {
+		return d
+	}
+
+	d = cfg.Timeout
+	longest := 0
+	for pattern, td := range cfg.Routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > longest {
+			d, longest = td, len(pattern)
+		}
+	}
+	return d
+}
+
+// handlerPanic is a panic on a handler running on a different goroutine.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// timeoutWriter forwards writes to w until the request times out, then drops them.
+// The handler has its own header map, copied to w when the header is written, so the
+// handler and the middleware never touch the same map concurrently.
+// It has no Unwrap method on purpose, the handler must never reach w directly.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+// finish copies the header of a handler which returned without writing it, so net/http
+// still sends it.
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteHeader {
+		copyHeader(tw.w.Header(), tw.h)
+	}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.writeHeader(statusCode)
+}
+
+func (tw *timeoutWriter) writeHeader(statusCode int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+
+	copyHeader(tw.w.Header(), tw.h)
+	tw.w.WriteHeader(statusCode)
+	// informational responses can be followed by the final one
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		tw.wroteHeader = true
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// flushTimeoutWriter is a timeoutWriter wrapping a http.Flusher.
+type flushTimeoutWriter struct {
+	*timeoutWriter
+}
+
+func (tw flushTimeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	tw.w.(http.Flusher).Flush()
+}
+
+// copyHeader replaces the values on dst by the ones on src.
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		dst[k] = append([]string(nil), vv...)
+	}
+}
@@ -0,0 +1,186 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+func TestTimeout(t *testing.T) {
+	tcs := []struct {
+		name       string
+		cfg        TimeoutConfig
+		handler    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name: "in time",
+			cfg:  TimeoutConfig{Timeout: time.Second},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Custom", "value")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("created"))
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   "created",
+			wantHeader: "value",
+		},
+		{
+			name: "in time without writing",
+			cfg:  TimeoutConfig{Timeout: time.Second},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Custom", "value")
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: "value",
+		},
+		{
+			name: "timed out",
+			cfg:  TimeoutConfig{Timeout: 10 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Custom", "value")
+				<-r.Context().Done()
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"error":"request timed out","tracking_id":"some-id"}` + "\n",
+		},
+		{
+			name: "timed out with custom status and message",
+			cfg:  TimeoutConfig{Timeout: 10 * time.Millisecond, StatusCode: http.StatusGatewayTimeout, Message: "upstream too slow"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   `{"error":"upstream too slow","tracking_id":"some-id"}` + "\n",
+		},
+		{
+			name: "timeout disabled for the route",
+			cfg:  TimeoutConfig{Timeout: time.Nanosecond, Routes: map[string]time.Duration{"/stream/": 0}},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Context().Deadline(); ok {
+					t.Error("want no deadline")
+				}
+				_, _ = w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/stream/events", nil)
+			r = r.WithContext(tracking.ContextWithExistingID(r.Context(), "some-id"))
+			w := httptest.NewRecorder()
+
+			TimeoutWith(tc.cfg)(http.HandlerFunc(tc.handler)).ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("want status: %d, got: %d", tc.wantStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tc.wantBody {
+				t.Errorf("want body: %q, got: %q", tc.wantBody, got)
+			}
+			if got := w.Header().Get("X-Custom"); got != tc.wantHeader {
+				t.Errorf("want X-Custom: %q, got: %q", tc.wantHeader, got)
+			}
+		})
+	}
+}
+
+func TestTimeoutDropsWritesAfterTimeout(t *testing.T) {
+	errs := make(chan error)
+	h := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Late", "late")
+		_, err := w.Write([]byte("too late"))
+		errs <- err
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err := <-errs; err != http.ErrHandlerTimeout {
+		t.Errorf("want: %v, got: %v", http.ErrHandlerTimeout, err)
+	}
+	if strings.Contains(w.Body.String(), "too late") {
+		t.Errorf("want late write dropped, got body: %q", w.Body)
+	}
+	if got := w.Header().Get("X-Late"); got != "" {
+		t.Errorf("want late header dropped, got: %q", got)
+	}
+}
+
+func TestTimeoutAbortsStartedResponse(t *testing.T) {
+	h := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+
+	w := httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("want panic: %v, got: %v", http.ErrAbortHandler, v)
+		}
+		if !w.Flushed {
+			t.Error("want the response flushed before the timeout")
+		}
+	}()
+
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("expected the response to be aborted")
+}
+
+func TestTimeoutPropagatesPanics(t *testing.T) {
+	h := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		v := recover()
+		p, ok := v.(handlerPanic)
+		if !ok || p.value != "boom" {
+			t.Errorf("want panic: boom, got: %v", v)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("expected the panic to be propagated")
+}
+
+func TestTimeoutFor(t *testing.T) {
+	cfg := TimeoutConfig{
+		Timeout: 5 * time.Second,
+		Routes: map[string]time.Duration{
+			"/reports":        time.Minute,
+			"/api/":           2 * time.Second,
+			"/api/exports/":   30 * time.Second,
+			"/api/exports/ws": -1,
+		},
+	}
+
+	tcs := []struct {
+		path string
+		want time.Duration
+	}{
+		{path: "/", want: 5 * time.Second},
+		{path: "/reports", want: time.Minute},
+		{path: "/reports/daily", want: 5 * time.Second},
+		{path: "/api/users", want: 2 * time.Second},
+		{path: "/api/exports/csv", want: 30 * time.Second},
+		{path: "/api/exports/ws", want: -1},
+	}
+	for _, tc := range tcs {
+		if got := cfg.timeoutFor(tc.path); got != tc.want {
+			t.Errorf("%s: want: %v, got: %v", tc.path, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package tracking
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Zipkin B3 headers, see https://github.com/openzipkin/b3-propagation
+const (
+	B3Header             = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+)
+
+// B3Propagator propagates Zipkin B3 headers. Extract understands both the single b3 header,
+// preferred if present, and the multiple X-B3-* headers. Inject writes the single header if
+// SingleHeader is true, the multiple headers otherwise.
+//
+// A missing sampling decision is treated as sampled.
+type B3Propagator struct {
+	SingleHeader bool
+}
+
+func (p B3Propagator) Extract(ctx context.Context, h http.Header) (context.Context, bool) {
+	if _, ok := TraceFromContext(ctx); ok {
+		return ctx, false
+	}
+
+	var tp TraceParent
+	var err error
+	if v := h.Get(B3Header); v != "" {
+		tp, err = parseB3Single(v)
+	} else {
+		tp, err = parseB3Multi(h)
+	}
+	if err != nil {
+		return ctx, false
+	}
+
+	tc, err := ContinueTraceContext(tp, TraceState{})
+	if err != nil {
+		return ctx, false
+	}
+	return ContextWithTrace(ctx, tc), true
+}
+
+func (p B3Propagator) Inject(ctx context.Context, h http.Header) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	sampled := "0"
+	if tc.Flags.Sampled() {
+		sampled = "1"
+	}
+
+	if p.SingleHeader {
+		v := tc.TraceID.String() + "-" + tc.SpanID.String() + "-" + sampled
+		if tc.ParentID.IsValid() {
+			v += "-" + tc.ParentID.String()
+		}
+		h.Set(B3Header, v)
+		return
+	}
+
+	h.Set(B3TraceIDHeader, tc.TraceID.String())
+	h.Set(B3SpanIDHeader, tc.SpanID.String())
+	if tc.ParentID.IsValid() {
+		h.Set(B3ParentSpanIDHeader, tc.ParentID.String())
+	}
+	h.Set(B3SampledHeader, sampled)
+}
+
+// parseB3Single parses {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, the last two are optional.
+// A header with only the sampling state carries no trace to continue and is rejected.
+func parseB3Single(v string) (TraceParent, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return TraceParent{}, fmt.Errorf("invalid b3 header %q", v)
+	}
+
+	sampled := ""
+	if len(parts) > 2 {
+		sampled = parts[2]
+	}
+
+	tp, err := b3TraceParent(parts[0], parts[1], sampled, "")
+	if err != nil {
+		return TraceParent{}, fmt.Errorf("invalid b3 header %q: %w", v, err)
+	}
+	if len(parts) == 4 {
+		var parent SpanID
+		if err := decodeLowerHex(parent[:], parts[3]); err != nil || len(parts[3]) != 16 {
+			return TraceParent{}, fmt.Errorf("invalid b3 header %q: invalid parent span id", v)
+		}
+	}
+
+	return tp, nil
+}
+
+func parseB3Multi(h http.Header) (TraceParent, error) {
+	traceID := h.Get(B3TraceIDHeader)
+	spanID := h.Get(B3SpanIDHeader)
+	if traceID == "" || spanID == "" {
+		return TraceParent{}, fmt.Errorf("missing %s or %s header", B3TraceIDHeader, B3SpanIDHeader)
+	}
+
+	return b3TraceParent(traceID, spanID, h.Get(B3SampledHeader), h.Get(B3FlagsHeader))
+}
+
+func b3TraceParent(traceID, spanID, sampled, flags string) (TraceParent, error) {
+	var tp TraceParent
+
+	switch len(traceID) {
+	case 16:
+		// 64 bits trace ids are left padded with zeros
+		if err := decodeLowerHex(tp.TraceID[8:], traceID); err != nil {
+			return TraceParent{}, fmt.Errorf("invalid trace id %q", traceID)
+		}
+	case 32:
+		if err := decodeLowerHex(tp.TraceID[:], traceID); err != nil {
+			return TraceParent{}, fmt.Errorf("invalid trace id %q", traceID)
+		}
+	default:
+		return TraceParent{}, fmt.Errorf("invalid trace id %q", traceID)
+	}
+	if !tp.TraceID.IsValid() {
+		return TraceParent{}, fmt.Errorf("invalid trace id %q", traceID)
+	}
+
+	if len(spanID) != 16 || decodeLowerHex(tp.ParentID[:], spanID) != nil || !tp.ParentID.IsValid() {
+		return TraceParent{}, fmt.Errorf("invalid span id %q", spanID)
+	}
+
+	switch {
+	case flags == "1", sampled == "d":
+		// debug implies sampled
+		tp.Flags = FlagSampled
+	case sampled == "", sampled == "1", sampled == "true":
+		tp.Flags = FlagSampled
+	case sampled == "0", sampled == "false":
+		tp.Flags = 0
+	default:
+		return TraceParent{}, fmt.Errorf("invalid sampling state %q", sampled)
+	}
+
+	return tp, nil
+}
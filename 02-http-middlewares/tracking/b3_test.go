@@ -0,0 +1,138 @@
+package tracking
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestB3PropagatorExtract(t *testing.T) {
+	tcs := []struct {
+		name        string
+		headers     map[string]string
+		wantOK      bool
+		wantTraceID string
+		wantParent  string
+		wantSampled bool
+	}{
+		{
+			name:        "single header",
+			headers:     map[string]string{B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+			wantOK:      true,
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "single header not sampled",
+			headers:     map[string]string{B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0"},
+			wantOK:      true,
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+		},
+		{
+			name:        "single header debug",
+			headers:     map[string]string{B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d"},
+			wantOK:      true,
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "single header without sampling state",
+			headers:     map[string]string{B3Header: "64fe8b2a57d3eff7-e457b5a2e4d86bd1"},
+			wantOK:      true,
+			wantTraceID: "000000000000000064fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name: "multiple headers",
+			headers: map[string]string{
+				B3TraceIDHeader:      "80f198ee56343ba864fe8b2a57d3eff7",
+				B3SpanIDHeader:       "e457b5a2e4d86bd1",
+				B3ParentSpanIDHeader: "05e3ac9a4f6e3b90",
+				B3SampledHeader:      "0",
+			},
+			wantOK:      true,
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+		},
+		{
+			name: "multiple headers debug flag",
+			headers: map[string]string{
+				B3TraceIDHeader: "80f198ee56343ba864fe8b2a57d3eff7",
+				B3SpanIDHeader:  "e457b5a2e4d86bd1",
+				B3FlagsHeader:   "1",
+			},
+			wantOK:      true,
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantParent:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{name: "only sampling state", headers: map[string]string{B3Header: "0"}},
+		{name: "invalid trace id", headers: map[string]string{B3Header: "xyz-e457b5a2e4d86bd1-1"}},
+		{name: "invalid sampling state", headers: map[string]string{B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-x"}},
+		{name: "missing span id", headers: map[string]string{B3TraceIDHeader: "80f198ee56343ba864fe8b2a57d3eff7"}},
+		{name: "no headers"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tc.headers {
+				h.Set(k, v)
+			}
+
+			ctx, ok := B3Propagator{}.Extract(context.Background(), h)
+			if ok != tc.wantOK {
+				t.Fatalf("want ok: %t, got: %t", tc.wantOK, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if got := TraceIDFromContext(ctx); got != tc.wantTraceID {
+				t.Errorf("want trace-id: %s, got: %s", tc.wantTraceID, got)
+			}
+			if got := ParentIDFromContext(ctx); got != tc.wantParent {
+				t.Errorf("want parent-id: %s, got: %s", tc.wantParent, got)
+			}
+			if got := Sampled(ctx); got != tc.wantSampled {
+				t.Errorf("want sampled: %t, got: %t", tc.wantSampled, got)
+			}
+		})
+	}
+}
+
+func TestB3PropagatorInject(t *testing.T) {
+	tp, err := ParseTraceParent("00-80f198ee56343ba864fe8b2a57d3eff7-05e3ac9a4f6e3b90-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tc, err := ContinueTraceContext(tp, TraceState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := ContextWithTrace(context.Background(), tc)
+
+	single := http.Header{}
+	B3Propagator{SingleHeader: true}.Inject(ctx, single)
+	if got, want := single.Get(B3Header), "80f198ee56343ba864fe8b2a57d3eff7-"+tc.SpanID.String()+"-1-05e3ac9a4f6e3b90"; got != want {
+		t.Errorf("want b3: %s, got: %s", want, got)
+	}
+
+	multi := http.Header{}
+	B3Propagator{}.Inject(ctx, multi)
+	want := map[string]string{
+		B3TraceIDHeader:      "80f198ee56343ba864fe8b2a57d3eff7",
+		B3SpanIDHeader:       tc.SpanID.String(),
+		B3ParentSpanIDHeader: "05e3ac9a4f6e3b90",
+		B3SampledHeader:      "1",
+	}
+	for k, v := range want {
+		if got := multi.Get(k); got != v {
+			t.Errorf("want %s: %s, got: %s", k, v, got)
+		}
+	}
+}
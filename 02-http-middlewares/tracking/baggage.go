@@ -0,0 +1,323 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BaggageHeader is the W3C baggage header, see https://www.w3.org/TR/baggage/
+const BaggageHeader = "baggage"
+
+// Baggage limits, as defined by the W3C baggage spec.
+const (
+	MaxBaggageMembers     = 180
+	MaxBaggageMemberBytes = 4096
+	MaxBaggageBytes       = 8192
+)
+
+var (
+	ErrInvalidBaggage  = errors.New("invalid baggage")
+	ErrBaggageTooLarge = errors.New("baggage exceeds the size limits")
+)
+
+// BaggageMember is a baggage list-member. Properties are kept as received, e.g. "ttl=60".
+type BaggageMember struct {
+	Key        string
+	Value      string
+	Properties []string
+}
+
+func (m BaggageMember) String() string {
+	var b strings.Builder
+	b.WriteString(m.Key)
+	b.WriteByte('=')
+	b.WriteString(encodeBaggageValue(m.Value))
+	for _, p := range m.Properties {
+		b.WriteByte(';')
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Baggage is a parsed baggage header. The zero value is an empty Baggage.
+// Baggage is immutable, the methods modifying it return a copy.
+type Baggage struct {
+	members []BaggageMember
+}
+
+// ParseBaggage parses and validates a baggage header value. When a key is repeated the last value wins.
+func ParseBaggage(s string) (Baggage, error) {
+	var b Baggage
+
+	if len(s) > MaxBaggageBytes {
+		return Baggage{}, fmt.Errorf("%w: %d bytes, the maximum is %d", ErrBaggageTooLarge, len(s), MaxBaggageBytes)
+	}
+
+	for _, raw := range strings.Split(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if len(raw) > MaxBaggageMemberBytes {
+			return Baggage{}, fmt.Errorf("%w: member with %d bytes, the maximum is %d", ErrBaggageTooLarge, len(raw), MaxBaggageMemberBytes)
+		}
+
+		m, err := parseBaggageMember(raw)
+		if err != nil {
+			return Baggage{}, err
+		}
+		b = b.set(m)
+	}
+
+	if len(b.members) > MaxBaggageMembers {
+		return Baggage{}, fmt.Errorf("%w: %d members, the maximum is %d", ErrBaggageTooLarge, len(b.members), MaxBaggageMembers)
+	}
+
+	return b, nil
+}
+
+func parseBaggageMember(raw string) (BaggageMember, error) {
+	parts := strings.Split(raw, ";")
+
+	kv := parts[0]
+	i := strings.IndexByte(kv, '=')
+	if i < 0 {
+		return BaggageMember{}, fmt.Errorf("%w: member %q has no '='", ErrInvalidBaggage, raw)
+	}
+
+	key := strings.TrimSpace(kv[:i])
+	if !isToken(key) {
+		return BaggageMember{}, fmt.Errorf("%w: invalid key %q", ErrInvalidBaggage, key)
+	}
+
+	rawValue := strings.TrimSpace(kv[i+1:])
+	if !isBaggageValue(rawValue) {
+		return BaggageMember{}, fmt.Errorf("%w: invalid value %q", ErrInvalidBaggage, rawValue)
+	}
+	value, err := url.PathUnescape(rawValue)
+	if err != nil {
+		return BaggageMember{}, fmt.Errorf("%w: invalid value %q: %v", ErrInvalidBaggage, rawValue, err)
+	}
+
+	m := BaggageMember{Key: key, Value: value}
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		pk := p
+		if j := strings.IndexByte(p, '='); j >= 0 {
+			pk = strings.TrimSpace(p[:j])
+			pv := strings.TrimSpace(p[j+1:])
+			if !isBaggageValue(pv) {
+				return BaggageMember{}, fmt.Errorf("%w: invalid property %q", ErrInvalidBaggage, p)
+			}
+			p = pk + "=" + pv
+		}
+		if !isToken(pk) {
+			return BaggageMember{}, fmt.Errorf("%w: invalid property %q", ErrInvalidBaggage, p)
+		}
+
+		m.Properties = append(m.Properties, p)
+	}
+
+	return m, nil
+}
+
+// Get returns the value of key.
+func (b Baggage) Get(key string) (string, bool) {
+	for _, m := range b.members {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set returns a copy of b with key set to value. It fails if key is not a valid token or
+// the resulting baggage exceeds the size limits.
+func (b Baggage) Set(key, value string) (Baggage, error) {
+	if !isToken(key) {
+		return b, fmt.Errorf("%w: invalid key %q", ErrInvalidBaggage, key)
+	}
+
+	m := BaggageMember{Key: key, Value: value}
+	if n := len(m.String()); n > MaxBaggageMemberBytes {
+		return b, fmt.Errorf("%w: member with %d bytes, the maximum is %d", ErrBaggageTooLarge, n, MaxBaggageMemberBytes)
+	}
+
+	nb := b.set(m)
+	if len(nb.members) > MaxBaggageMembers {
+		return b, fmt.Errorf("%w: %d members, the maximum is %d", ErrBaggageTooLarge, len(nb.members), MaxBaggageMembers)
+	}
+	if n := len(nb.String()); n > MaxBaggageBytes {
+		return b, fmt.Errorf("%w: %d bytes, the maximum is %d", ErrBaggageTooLarge, n, MaxBaggageBytes)
+	}
+
+	return nb, nil
+}
+
+func (b Baggage) set(m BaggageMember) Baggage {
+	members := make([]BaggageMember, 0, len(b.members)+1)
+	for _, old := range b.members {
+		if old.Key != m.Key {
+			members = append(members, old)
+		}
+	}
+	return Baggage{members: append(members, m)}
+}
+
+// Delete returns a copy of b without key.
+func (b Baggage) Delete(key string) Baggage {
+	members := make([]BaggageMember, 0, len(b.members))
+	for _, m := range b.members {
+		if m.Key != key {
+			members = append(members, m)
+		}
+	}
+	return Baggage{members: members}
+}
+
+// Len returns the number of members in b.
+func (b Baggage) Len() int {
+	return len(b.members)
+}
+
+// Members returns a copy of b members.
+func (b Baggage) Members() []BaggageMember {
+	return append([]BaggageMember(nil), b.members...)
+}
+
+// String returns b encoded as a baggage header value.
+func (b Baggage) String() string {
+	parts := make([]string, 0, len(b.members))
+	for _, m := range b.members {
+		parts = append(parts, m.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+type baggageKey struct{}
+
+// ContextWithBaggage returns a copy of ctx carrying b.
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey{}, b)
+}
+
+// BaggageFromContext returns the Baggage carried by ctx, it's empty if there is none.
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey{}).(Baggage)
+	return b
+}
+
+// ExtractBaggage reads the baggage headers from h.
+func ExtractBaggage(h http.Header) (Baggage, error) {
+	return ParseBaggage(strings.Join(h.Values(BaggageHeader), ","))
+}
+
+// InjectBaggage writes the baggage in ctx, if any, to h.
+func InjectBaggage(ctx context.Context, h http.Header) {
+	if b := BaggageFromContext(ctx); b.Len() > 0 {
+		h.Set(BaggageHeader, b.String())
+	}
+}
+
+// BaggageKey is a baggage entry with typed accessors, e.g.
+//
+//	const Tenant tracking.BaggageKey = "tenant"
+//	ctx, err := Tenant.Set(ctx, "acme")
+//	tenant, ok := Tenant.Get(ctx)
+type BaggageKey string
+
+// Get returns the value of k in the ctx baggage.
+func (k BaggageKey) Get(ctx context.Context) (string, bool) {
+	return BaggageFromContext(ctx).Get(string(k))
+}
+
+// Set returns a copy of ctx with k set to v in its baggage.
+func (k BaggageKey) Set(ctx context.Context, v string) (context.Context, error) {
+	b, err := BaggageFromContext(ctx).Set(string(k), v)
+	if err != nil {
+		return ctx, err
+	}
+	return ContextWithBaggage(ctx, b), nil
+}
+
+// Int returns the value of k as an int, ok is false if it's absent or not an integer.
+func (k BaggageKey) Int(ctx context.Context) (int, bool) {
+	v, ok := k.Get(ctx)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(v)
+	return i, err == nil
+}
+
+// SetInt is Set for int values.
+func (k BaggageKey) SetInt(ctx context.Context, v int) (context.Context, error) {
+	return k.Set(ctx, strconv.Itoa(v))
+}
+
+// Bool returns the value of k as a bool, ok is false if it's absent or not a boolean.
+func (k BaggageKey) Bool(ctx context.Context) (bool, bool) {
+	v, ok := k.Get(ctx)
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
+// SetBool is Set for bool values.
+func (k BaggageKey) SetBool(ctx context.Context, v bool) (context.Context, error) {
+	return k.Set(ctx, strconv.FormatBool(v))
+}
+
+// isToken reports whether s is a RFC 7230 token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBaggageOctet(c byte) bool {
+	return c == 0x21 || 0x23 <= c && c <= 0x2b || 0x2d <= c && c <= 0x3a || 0x3c <= c && c <= 0x5b || 0x5d <= c && c <= 0x7e
+}
+
+func isBaggageValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isBaggageOctet(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeBaggageValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isBaggageOctet(c) && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseBaggage(t *testing.T) {
+	tcs := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr error
+	}{
+		{name: "empty", value: "", want: ""},
+		{name: "single member", value: "tenant=acme", want: "tenant=acme"},
+		{name: "spaces and properties", value: " tenant = acme ; ttl=60 , tier=gold;final", want: "tenant=acme;ttl=60,tier=gold;final"},
+		{name: "percent encoded value", value: "user=Jos%C3%A9%20Silva", want: "user=Jos%C3%A9%20Silva"},
+		{name: "repeated key last wins", value: "a=1,b=2,a=3", want: "b=2,a=3"},
+		{name: "no equals", value: "tenant", wantErr: ErrInvalidBaggage},
+		{name: "invalid key", value: "ten ant=acme", wantErr: ErrInvalidBaggage},
+		{name: "invalid value", value: `tenant="acme"`, wantErr: ErrInvalidBaggage},
+		{name: "invalid percent encoding", value: "tenant=%zz", wantErr: ErrInvalidBaggage},
+		{name: "too many members", value: manyMembers(MaxBaggageMembers + 1), wantErr: ErrBaggageTooLarge},
+		{name: "member too large", value: "a=" + strings.Repeat("x", MaxBaggageMemberBytes), wantErr: ErrBaggageTooLarge},
+		{name: "too large", value: strings.Repeat("a=1,", MaxBaggageBytes/4+1), wantErr: ErrBaggageTooLarge},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := ParseBaggage(tc.value)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("want: %v, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := b.String(); got != tc.want {
+				t.Errorf("want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBaggageDecodesValues(t *testing.T) {
+	b, err := ParseBaggage("user=Jos%C3%A9%20Silva")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, _ := b.Get("user"); got != "José Silva" {
+		t.Errorf("want: José Silva, got: %s", got)
+	}
+}
+
+func TestBaggageSetLimits(t *testing.T) {
+	b, err := ParseBaggage(manyMembers(MaxBaggageMembers))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := b.Set("one-more", "1"); !errors.Is(err, ErrBaggageTooLarge) {
+		t.Errorf("want: %v, got: %v", ErrBaggageTooLarge, err)
+	}
+	if _, err := b.Set("k0", "replacing is fine"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := (Baggage{}).Set("k", strings.Repeat("x", MaxBaggageMemberBytes)); !errors.Is(err, ErrBaggageTooLarge) {
+		t.Errorf("want: %v, got: %v", ErrBaggageTooLarge, err)
+	}
+	if _, err := (Baggage{}).Set("invalid key", "v"); !errors.Is(err, ErrInvalidBaggage) {
+		t.Errorf("want: %v, got: %v", ErrInvalidBaggage, err)
+	}
+}
+
+func TestBaggageKey(t *testing.T) {
+	const (
+		tenant     BaggageKey = "tenant"
+		tier       BaggageKey = "tier"
+		experiment BaggageKey = "experiment"
+	)
+
+	ctx, err := tenant.Set(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ctx, err = tier.SetInt(ctx, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ctx, err = experiment.SetBool(ctx, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, ok := tenant.Get(ctx); !ok || got != "acme" {
+		t.Errorf("want tenant: acme, got: %q %t", got, ok)
+	}
+	if got, ok := tier.Int(ctx); !ok || got != 2 {
+		t.Errorf("want tier: 2, got: %d %t", got, ok)
+	}
+	if got, ok := experiment.Bool(ctx); !ok || !got {
+		t.Errorf("want experiment: true, got: %t %t", got, ok)
+	}
+	if _, ok := tenant.Int(ctx); ok {
+		t.Error("expected tenant not to be an int")
+	}
+	if _, ok := BaggageKey("absent").Get(ctx); ok {
+		t.Error("expected absent not to be found")
+	}
+}
+
+func TestExtractInjectBaggage(t *testing.T) {
+	h := http.Header{}
+	h.Add(BaggageHeader, "tenant=acme")
+	h.Add(BaggageHeader, "tier=gold")
+
+	b, err := ExtractBaggage(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := http.Header{}
+	InjectBaggage(ContextWithBaggage(context.Background(), b), out)
+
+	if got, want := out.Get(BaggageHeader), "tenant=acme,tier=gold"; got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func manyMembers(n int) string {
+	members := make([]string, n)
+	for i := range members {
+		members[i] = "k" + strconv.Itoa(i) + "=v"
+	}
+	return strings.Join(members, ",")
+}
@@ -2,22 +2,44 @@ package tracking
 
 import (
 	"context"
+	"errors"
+	"fmt"
+)
+
+// Header is the default http header carrying the tracking id.
+const Header = "X-TrackingId"
+
+// MaxIDLength is the default maximum length, in bytes, of a tracking id received from a client.
+const MaxIDLength = 128
 
-	"github.com/google/uuid"
+var (
+	ErrEmptyID   = errors.New("tracking id is empty")
+	ErrIDTooLong = errors.New("tracking id is too long")
+	ErrInvalidID = errors.New("tracking id contains invalid characters")
 )
 
 type key struct{}
 
 var ctxKey = key{}
 
-func ContextWithID(ctx context.Context) context.Context {
-	var id string
+// ContextWithID returns a copy of ctx carrying a new tracking id generated by DefaultGenerator.
+func ContextWithID(ctx context.Context) (context.Context, error) {
+	return ContextWithGeneratedID(ctx, DefaultGenerator)
+}
 
-	// TODO: handle the error properly if you are planing to copy this!
-	if uuid, err := uuid.NewUUID(); err == nil {
-		id = uuid.String()
+// ContextWithGeneratedID returns a copy of ctx carrying a new tracking id generated by g.
+func ContextWithGeneratedID(ctx context.Context, g Generator) (context.Context, error) {
+	id, err := g.Generate()
+	if err != nil {
+		return ctx, fmt.Errorf("could not generate tracking id: %w", err)
 	}
 
+	return context.WithValue(ctx, ctxKey, id), nil
+}
+
+// ContextWithExistingID returns a copy of ctx carrying id as the tracking id.
+// It does not validate id, use ValidateID for ids coming from untrusted sources.
+func ContextWithExistingID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, ctxKey, id)
 }
 
@@ -25,3 +47,36 @@ func IdFromContext(ctx context.Context) string {
 	id, _ := ctx.Value(ctxKey).(string)
 	return id
 }
+
+// ValidateID checks id is not empty, is at most maxLen bytes long and only contains
+// ASCII letters, digits, '-', '_', '.' and ':'. A maxLen <= 0 means MaxIDLength.
+func ValidateID(id string, maxLen int) error {
+	if maxLen <= 0 {
+		maxLen = MaxIDLength
+	}
+
+	if id == "" {
+		return ErrEmptyID
+	}
+	if len(id) > maxLen {
+		return ErrIDTooLong
+	}
+
+	for i := 0; i < len(id); i++ {
+		if !isIDChar(id[i]) {
+			return ErrInvalidID
+		}
+	}
+
+	return nil
+}
+
+func isIDChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	case c == '-', c == '_', c == '.', c == ':':
+		return true
+	}
+	return false
+}
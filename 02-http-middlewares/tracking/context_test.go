@@ -0,0 +1,41 @@
+package tracking
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateID(t *testing.T) {
+	tcs := []struct {
+		name   string
+		id     string
+		maxLen int
+		want   error
+	}{
+		{name: "valid", id: "2f1c0a9e-1b7d-4c1e-9b0a-6f3b8e7d5a21", want: nil},
+		{name: "empty", id: "", want: ErrEmptyID},
+		{name: "too long", id: strings.Repeat("a", MaxIDLength+1), want: ErrIDTooLong},
+		{name: "custom max length", id: "abcde", maxLen: 4, want: ErrIDTooLong},
+		{name: "space", id: "an id", want: ErrInvalidID},
+		{name: "header injection", id: "id\r\nX-Evil: 1", want: ErrInvalidID},
+		{name: "non ASCII", id: "idé", want: ErrInvalidID},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ValidateID(tc.id, tc.maxLen); got != tc.want {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestContextWithExistingID(t *testing.T) {
+	want := "some-id"
+	ctx := ContextWithExistingID(context.Background(), want)
+
+	if got := IdFromContext(ctx); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
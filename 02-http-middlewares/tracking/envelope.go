@@ -0,0 +1,55 @@
+package tracking
+
+import (
+	"context"
+	"time"
+)
+
+// Envelope carries a payload across goroutines, e.g. on a channel, together with the tracking
+// information of the context which produced it. Use NewEnvelope on the producer side and
+// Envelope.Context on the consumer side, so the background work can be traced back to the
+// request which caused it.
+type Envelope struct {
+	TrackingID string
+	// Trace is only meaningful if HasTrace is true.
+	Trace      TraceContext
+	HasTrace   bool
+	Baggage    Baggage
+	EnqueuedAt time.Time
+	Payload    interface{}
+}
+
+// NewEnvelope returns an Envelope with payload and the tracking id, trace context and baggage of ctx.
+func NewEnvelope(ctx context.Context, payload interface{}) Envelope {
+	tc, ok := TraceFromContext(ctx)
+
+	return Envelope{
+		TrackingID: IdFromContext(ctx),
+		Trace:      tc,
+		HasTrace:   ok,
+		Baggage:    BaggageFromContext(ctx),
+		EnqueuedAt: time.Now(),
+		Payload:    payload,
+	}
+}
+
+// Context returns a copy of parent carrying the tracking id, trace context and baggage of e.
+// parent is usually the consumer own context, not the request one which might be already done.
+func (e Envelope) Context(parent context.Context) context.Context {
+	ctx := parent
+	if e.TrackingID != "" {
+		ctx = ContextWithExistingID(ctx, e.TrackingID)
+	}
+	if e.HasTrace {
+		ctx = ContextWithTrace(ctx, e.Trace)
+	}
+	if e.Baggage.Len() > 0 {
+		ctx = ContextWithBaggage(ctx, e.Baggage)
+	}
+	return ctx
+}
+
+// Age returns how long ago e was created, i.e. for how long it has been queued.
+func (e Envelope) Age() time.Duration {
+	return time.Since(e.EnqueuedAt)
+}
@@ -0,0 +1,60 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	trace, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := ContextWithTrace(ContextWithExistingID(context.Background(), "some-id"), trace)
+	if ctx, err = BaggageKey("tenant").Set(ctx, "acme"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ch := make(chan Envelope, 1)
+	ch <- NewEnvelope(ctx, 42)
+	close(ch)
+
+	for e := range ch {
+		if e.Payload.(int) != 42 {
+			t.Errorf("want payload: 42, got: %v", e.Payload)
+		}
+		if e.Age() < 0 || e.Age() > time.Minute {
+			t.Errorf("unexpected age: %s", e.Age())
+		}
+
+		got := e.Context(context.Background())
+		if id := IdFromContext(got); id != "some-id" {
+			t.Errorf("want tracking id: some-id, got: %s", id)
+		}
+		if id := TraceIDFromContext(got); id != trace.TraceID.String() {
+			t.Errorf("want trace-id: %s, got: %s", trace.TraceID, id)
+		}
+		if tenant, _ := BaggageKey("tenant").Get(got); tenant != "acme" {
+			t.Errorf("want tenant: acme, got: %s", tenant)
+		}
+
+		_, span := StartSpan(got, "consume")
+		if span.ParentID() != trace.SpanID {
+			t.Errorf("want the consumer span parent to be the producer span %s, got: %s", trace.SpanID, span.ParentID())
+		}
+	}
+}
+
+func TestEnvelopeWithoutTracking(t *testing.T) {
+	e := NewEnvelope(context.Background(), "payload")
+	ctx := e.Context(context.Background())
+
+	if id := IdFromContext(ctx); id != "" {
+		t.Errorf("expected no tracking id, got: %s", id)
+	}
+	if _, ok := TraceFromContext(ctx); ok {
+		t.Error("expected no trace context")
+	}
+}
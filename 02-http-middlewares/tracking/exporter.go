@@ -0,0 +1,286 @@
+package tracking
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere. The Tracer calls ExportSpans from a single goroutine.
+type Exporter interface {
+	ExportSpans(spans []SpanData) error
+	Shutdown() error
+}
+
+// JSONExporter writes each span as a JSON object on its own line, newline-delimited JSON.
+type JSONExporter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+// NewJSONExporter returns a JSONExporter writing to w. If w is an io.Closer, it's closed on Shutdown.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	e := &JSONExporter{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		e.c = c
+	}
+	return e
+}
+
+// NewJSONFileExporter returns a JSONExporter appending to the file at path, creating it if needed.
+func NewJSONFileExporter(path string) (*JSONExporter, error) {
+	f, err := openExportFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONExporter(f), nil
+}
+
+type jsonSpan struct {
+	SpanData
+	TraceID    string  `json:"trace_id"`
+	SpanID     string  `json:"span_id"`
+	ParentID   string  `json:"parent_id,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func (e *JSONExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		js := jsonSpan{
+			SpanData:   s,
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			DurationMs: float64(s.End.Sub(s.Start)) / float64(time.Millisecond),
+		}
+		if s.ParentID.IsValid() {
+			js.ParentID = s.ParentID.String()
+		}
+
+		if err := enc.Encode(js); err != nil {
+			return fmt.Errorf("could not write span %s: %w", s.Name, err)
+		}
+	}
+
+	return e.w.Flush()
+}
+
+func (e *JSONExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
+
+// OTLPJSONExporter writes each batch of spans as an OTLP/JSON ExportTraceServiceRequest on its
+// own line, the same format as the OpenTelemetry Collector file exporter. The files can be
+// replayed to any OTLP compatible backend.
+type OTLPJSONExporter struct {
+	ServiceName string
+
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+// NewOTLPJSONExporter returns an OTLPJSONExporter writing to w with service.name set to
+// serviceName. If w is an io.Closer, it's closed on Shutdown.
+func NewOTLPJSONExporter(w io.Writer, serviceName string) *OTLPJSONExporter {
+	e := &OTLPJSONExporter{ServiceName: serviceName, w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		e.c = c
+	}
+	return e
+}
+
+// NewOTLPJSONFileExporter returns an OTLPJSONExporter appending to the file at path, creating it if needed.
+func NewOTLPJSONFileExporter(path, serviceName string) (*OTLPJSONExporter, error) {
+	f, err := openExportFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewOTLPJSONExporter(f, serviceName), nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpSpanKindInternal is SPAN_KIND_INTERNAL.
+const otlpSpanKindInternal = 1
+
+func (e *OTLPJSONExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: int(s.Status), Message: s.StatusMessage},
+		}
+		if s.ParentID.IsValid() {
+			span.ParentSpanID = s.ParentID.String()
+		}
+		if s.TrackingID != "" {
+			span.Attributes = append(span.Attributes, otlpKeyValue{Key: "tracking.id", Value: otlpValue(s.TrackingID)})
+		}
+
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpValue(e.ServiceName)},
+		}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+
+	if err := json.NewEncoder(e.w).Encode(req); err != nil {
+		return fmt.Errorf("could not write OTLP/JSON spans: %w", err)
+	}
+	return e.w.Flush()
+}
+
+func (e *OTLPJSONExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpValue(attrs[k])})
+	}
+	return kvs
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int32:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case uint:
+		s := strconv.FormatUint(uint64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	case uint32:
+		s := strconv.FormatUint(uint64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	case float32:
+		f := float64(v)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	case time.Duration:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+func openExportFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open span export file: %w", err)
+	}
+	return f, nil
+}
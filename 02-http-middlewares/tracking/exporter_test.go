@@ -0,0 +1,170 @@
+package tracking
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSpans() []SpanData {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	root := SpanData{
+		Name:       "GET /users",
+		TrackingID: "some-id",
+		TraceID:    TraceID{1},
+		SpanID:     SpanID{1},
+		Start:      start,
+		End:        start.Add(120 * time.Millisecond),
+		Status:     StatusOK,
+	}
+	child := SpanData{
+		Name:          "fetch",
+		TraceID:       TraceID{1},
+		SpanID:        SpanID{2},
+		ParentID:      SpanID{1},
+		Start:         start.Add(10 * time.Millisecond),
+		End:           start.Add(100 * time.Millisecond),
+		Attributes:    map[string]interface{}{"user.id": "42", "retries": 1},
+		Status:        StatusError,
+		StatusMessage: "timeout",
+	}
+	return []SpanData{child, root}
+}
+
+func TestJSONExporter(t *testing.T) {
+	path := filepath.Join(tempDir(t), "spans.ndjson")
+	e, err := NewJSONFileExporter(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := e.ExportSpans(testSpans()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := e.Shutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	var lines []map[string]interface{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not valid JSON: %v", s.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got: %d", len(lines))
+	}
+
+	child := lines[0]
+	want := map[string]interface{}{
+		"name":           "fetch",
+		"trace_id":       "01000000000000000000000000000000",
+		"span_id":        "0200000000000000",
+		"parent_id":      "0100000000000000",
+		"status":         "error",
+		"status_message": "timeout",
+		"duration_ms":    float64(90),
+	}
+	for k, v := range want {
+		if child[k] != v {
+			t.Errorf("want %s: %v, got: %v", k, v, child[k])
+		}
+	}
+
+	if _, ok := lines[1]["parent_id"]; ok {
+		t.Errorf("expected the root span to have no parent_id, got: %v", lines[1]["parent_id"])
+	}
+	if got := lines[1]["tracking_id"]; got != "some-id" {
+		t.Errorf("want tracking_id: some-id, got: %v", got)
+	}
+}
+
+func TestOTLPJSONExporter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	e := NewOTLPJSONExporter(buff, "test-service")
+
+	if err := e.ExportSpans(testSpans()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(buff.Bytes(), &req); err != nil {
+		t.Fatalf("invalid OTLP/JSON %s: %v", buff, err)
+	}
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("want 1 resource with 1 scope, got: %+v", req)
+	}
+	if got := *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; got != "test-service" {
+		t.Errorf("want service.name: test-service, got: %s", got)
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got: %d", len(spans))
+	}
+
+	child := spans[0]
+	if child.ParentSpanID != "0100000000000000" {
+		t.Errorf("want parentSpanId: 0100000000000000, got: %s", child.ParentSpanID)
+	}
+	if want := "1591012800010000000"; child.StartTimeUnixNano != want {
+		t.Errorf("want startTimeUnixNano: %s, got: %s", want, child.StartTimeUnixNano)
+	}
+	if child.Status.Code != 2 || child.Status.Message != "timeout" {
+		t.Errorf("want status: {2 timeout}, got: %+v", child.Status)
+	}
+	if len(child.Attributes) != 2 || child.Attributes[0].Key != "retries" || *child.Attributes[0].Value.IntValue != "1" {
+		t.Errorf("want sorted attributes with retries as int, got: %+v", child.Attributes)
+	}
+}
+
+func TestJSONExporterAppends(t *testing.T) {
+	path := filepath.Join(tempDir(t), "spans.ndjson")
+
+	for i := 0; i < 2; i++ {
+		e, err := NewJSONFileExporter(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := e.ExportSpans(testSpans()[:1]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := e.Shutdown(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != 2 {
+		t.Errorf("want 2 lines, got: %d", n)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tracking")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
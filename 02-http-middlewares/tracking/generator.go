@@ -0,0 +1,213 @@
+package tracking
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Generator generates new tracking ids.
+type Generator interface {
+	Generate() (string, error)
+}
+
+// GeneratorFunc is an adapter to allow the use of ordinary functions as Generator.
+type GeneratorFunc func() (string, error)
+
+// Generate calls f().
+func (f GeneratorFunc) Generate() (string, error) {
+	return f()
+}
+
+// DefaultGenerator is the Generator used by ContextWithID.
+var DefaultGenerator Generator = UUIDv4{}
+
+// UUIDv4 generates random UUIDs.
+type UUIDv4 struct{}
+
+func (UUIDv4) Generate() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("could not generate UUIDv4: %w", err)
+	}
+	return id.String(), nil
+}
+
+// UUIDv7 generates time-sortable UUIDs, as defined on RFC 9562, with millisecond precision.
+type UUIDv7 struct{}
+
+func (UUIDv7) Generate() (string, error) {
+	return newUUIDv7(time.Now(), rand.Reader)
+}
+
+func newUUIDv7(t time.Time, r io.Reader) (string, error) {
+	var id uuid.UUID
+
+	if _, err := io.ReadFull(r, id[6:]); err != nil {
+		return "", fmt.Errorf("could not generate UUIDv7: %w", err)
+	}
+
+	putUint48(id[:6], unixMilli(t))
+	id[6] = id[6]&0x0f | 0x70 // version 7
+	id[8] = id[8]&0x3f | 0x80 // variant RFC 4122
+
+	return id.String(), nil
+}
+
+// crockford is the Crockford's base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates time-sortable Universally Unique Lexicographically Sortable Identifiers,
+// see https://github.com/ulid/spec.
+type ULID struct{}
+
+func (ULID) Generate() (string, error) {
+	return newULID(time.Now(), rand.Reader)
+}
+
+func newULID(t time.Time, r io.Reader) (string, error) {
+	var id [16]byte
+
+	if _, err := io.ReadFull(r, id[6:]); err != nil {
+		return "", fmt.Errorf("could not generate ULID: %w", err)
+	}
+	putUint48(id[:6], unixMilli(t))
+
+	// 128 bits encoded as 26 characters of 5 bits, the first character holds only 3 bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out[:]), nil
+}
+
+// base62 is the alphabet used by KSUIDs.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ksuidEpoch is the KSUID epoch, 2014-05-13T16:53:20Z.
+const ksuidEpoch = 1400000000
+
+// KSUID generates time-sortable K-Sortable Unique IDentifiers, see https://github.com/segmentio/ksuid.
+// They have seconds precision.
+type KSUID struct{}
+
+func (KSUID) Generate() (string, error) {
+	return newKSUID(time.Now(), rand.Reader)
+}
+
+func newKSUID(t time.Time, r io.Reader) (string, error) {
+	var id [20]byte
+
+	ts := t.Unix() - ksuidEpoch
+	if ts < 0 || ts > 1<<32-1 {
+		return "", fmt.Errorf("could not generate KSUID: time %s out of range", t)
+	}
+
+	if _, err := io.ReadFull(r, id[4:]); err != nil {
+		return "", fmt.Errorf("could not generate KSUID: %w", err)
+	}
+	binary.BigEndian.PutUint32(id[:4], uint32(ts))
+
+	// 160 bits always fit in 27 base62 characters.
+	var out [27]byte
+	n := new(big.Int).SetBytes(id[:])
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	for i := 26; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = base62[mod.Int64()]
+	}
+
+	return string(out[:]), nil
+}
+
+// snowflakeEpoch is the Snowflake epoch, 2020-01-01T00:00:00Z.
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+
+	// MaxSnowflakeNode is the highest node id accepted by NewSnowflake.
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+	maxSequence      = 1<<snowflakeSequenceBits - 1
+)
+
+// ErrClockMovedBackwards is returned by Snowflake when the clock goes back in time.
+var ErrClockMovedBackwards = errors.New("clock moved backwards")
+
+// Snowflake generates Twitter's Snowflake style ids: 41 bits of milliseconds since 2020-01-01,
+// 10 bits of node id and 12 bits of sequence, encoded as a decimal number.
+// Ids are unique as long as each instance of the service uses a different node id.
+type Snowflake struct {
+	node int64
+
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+
+	now func() time.Time
+}
+
+// NewSnowflake returns a Snowflake generator for the node. The node must be in [0, MaxSnowflakeNode].
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node must be in [0, %d], got %d", MaxSnowflakeNode, node)
+	}
+
+	return &Snowflake{node: node, now: time.Now}, nil
+}
+
+func (s *Snowflake) Generate() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := unixMilli(s.now()) - unixMilli(snowflakeEpoch)
+	if ms < s.lastMs {
+		return "", fmt.Errorf("could not generate snowflake id: %w by %dms", ErrClockMovedBackwards, s.lastMs-ms)
+	}
+
+	if ms == s.lastMs {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// sequence exhausted for this millisecond, wait for the next one
+			for ms <= s.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = unixMilli(s.now()) - unixMilli(snowflakeEpoch)
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMs = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeSequenceBits) | s.node<<snowflakeSequenceBits | s.sequence
+	return strconv.FormatInt(id, 10), nil
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func putUint48(b []byte, v int64) {
+	b[0] = byte(v >> 40)
+	b[1] = byte(v >> 32)
+	b[2] = byte(v >> 24)
+	b[3] = byte(v >> 16)
+	b[4] = byte(v >> 8)
+	b[5] = byte(v)
+}
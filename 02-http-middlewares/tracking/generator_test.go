@@ -0,0 +1,175 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerators(t *testing.T) {
+	snowflake, err := NewSnowflake(42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tcs := []struct {
+		name      string
+		generator Generator
+		format    *regexp.Regexp
+	}{
+		{name: "UUIDv4", generator: UUIDv4{}, format: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "UUIDv7", generator: UUIDv7{}, format: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "ULID", generator: ULID{}, format: regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+		{name: "KSUID", generator: KSUID{}, format: regexp.MustCompile(`^[0-9A-Za-z]{27}$`)},
+		{name: "Snowflake", generator: snowflake, format: regexp.MustCompile(`^[0-9]+$`)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				id, err := tc.generator.Generate()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !tc.format.MatchString(id) {
+					t.Fatalf("id %q does not match %s", id, tc.format)
+				}
+				if err := ValidateID(id, 0); err != nil {
+					t.Fatalf("id %q is not a valid tracking id: %v", id, err)
+				}
+				if seen[id] {
+					t.Fatalf("duplicated id %q", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestSortableGenerators(t *testing.T) {
+	tcs := []struct {
+		name     string
+		generate func(time.Time) (string, error)
+	}{
+		{name: "UUIDv7", generate: func(t time.Time) (string, error) { return newUUIDv7(t, rand.Reader) }},
+		{name: "ULID", generate: func(t time.Time) (string, error) { return newULID(t, rand.Reader) }},
+		{name: "KSUID", generate: func(t time.Time) (string, error) { return newKSUID(t, rand.Reader) }},
+	}
+
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []string
+			for i := 0; i < 100; i++ {
+				id, err := tc.generate(start.Add(time.Duration(i) * time.Second))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				ids = append(ids, id)
+			}
+
+			if !sort.StringsAreSorted(ids) {
+				t.Errorf("expected ids generated over time to be sorted: %v", ids)
+			}
+		})
+	}
+}
+
+func TestUUIDv7Timestamp(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	id, err := newUUIDv7(now, rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	u := uuid.MustParse(id)
+	ms := int64(u[0])<<40 | int64(u[1])<<32 | int64(u[2])<<24 | int64(u[3])<<16 | int64(u[4])<<8 | int64(u[5])
+	if want := unixMilli(now); ms != want {
+		t.Errorf("want timestamp: %d, got: %d", want, ms)
+	}
+}
+
+func TestULIDKnownValue(t *testing.T) {
+	// all zero random part and timestamp 1 ms
+	id, err := newULID(time.Unix(0, int64(time.Millisecond)), bytes.NewReader(make([]byte, 10)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := "00000000010000000000000000"; id != want {
+		t.Errorf("want: %s, got: %s", want, id)
+	}
+}
+
+func TestNewSnowflakeInvalidNode(t *testing.T) {
+	for _, node := range []int64{-1, MaxSnowflakeNode + 1} {
+		if _, err := NewSnowflake(node); err == nil {
+			t.Errorf("expected an error for node %d", node)
+		}
+	}
+}
+
+func TestSnowflakeSequence(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s, err := NewSnowflake(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	first, err := s.Generate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := s.Generate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first == second {
+		t.Errorf("expected different ids on the same millisecond, got %s twice", first)
+	}
+	if s.sequence != 1 {
+		t.Errorf("want sequence: 1, got: %d", s.sequence)
+	}
+}
+
+func TestSnowflakeClockMovedBackwards(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s, err := NewSnowflake(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	if _, err := s.Generate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = now.Add(-time.Second)
+	if _, err := s.Generate(); !errors.Is(err, ErrClockMovedBackwards) {
+		t.Errorf("want: %v, got: %v", ErrClockMovedBackwards, err)
+	}
+}
+
+func TestContextWithGeneratedIDError(t *testing.T) {
+	wantErr := errors.New("no entropy")
+	g := GeneratorFunc(func() (string, error) { return "", wantErr })
+
+	ctx, err := ContextWithGeneratedID(context.Background(), g)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("want: %v, got: %v", wantErr, err)
+	}
+	if id := IdFromContext(ctx); id != "" {
+		t.Errorf("expected no tracking id, got: %s", id)
+	}
+}
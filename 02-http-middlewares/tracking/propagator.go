@@ -0,0 +1,108 @@
+package tracking
+
+import (
+	"context"
+	"net/http"
+)
+
+// Propagator reads and writes the tracking information of a request from and to http headers.
+//
+// Extract returns ctx with what it read from h, ok is false if h has nothing valid for it.
+// Extract does nothing if ctx already carries what it would extract, so when propagators
+// are tried in order, the first one to find something wins.
+type Propagator interface {
+	Extract(ctx context.Context, h http.Header) (newCtx context.Context, ok bool)
+	Inject(ctx context.Context, h http.Header)
+}
+
+// Propagators is a Propagator trying each of its propagators in order on Extract and
+// calling all of them on Inject.
+type Propagators []Propagator
+
+// DefaultPropagators returns the W3C trace context and baggage propagators.
+func DefaultPropagators() Propagators {
+	return Propagators{TraceContextPropagator{}, BaggagePropagator{}}
+}
+
+// Extract calls Extract on each propagator in order, ok is true if any of them found something.
+func (ps Propagators) Extract(ctx context.Context, h http.Header) (context.Context, bool) {
+	var found bool
+	for _, p := range ps {
+		var ok bool
+		ctx, ok = p.Extract(ctx, h)
+		found = found || ok
+	}
+	return ctx, found
+}
+
+// Inject calls Inject on each propagator.
+func (ps Propagators) Inject(ctx context.Context, h http.Header) {
+	for _, p := range ps {
+		p.Inject(ctx, h)
+	}
+}
+
+// TraceContextPropagator propagates the W3C traceparent and tracestate headers.
+// Extracting continues the upstream trace with a new span id.
+type TraceContextPropagator struct{}
+
+func (TraceContextPropagator) Extract(ctx context.Context, h http.Header) (context.Context, bool) {
+	if _, ok := TraceFromContext(ctx); ok {
+		return ctx, false
+	}
+
+	tc, err := ExtractTraceContext(h)
+	if err != nil {
+		return ctx, false
+	}
+	return ContextWithTrace(ctx, tc), true
+}
+
+func (TraceContextPropagator) Inject(ctx context.Context, h http.Header) {
+	InjectTraceContext(ctx, h)
+}
+
+// BaggagePropagator propagates the W3C baggage header. Invalid or oversized baggage is dropped.
+type BaggagePropagator struct{}
+
+func (BaggagePropagator) Extract(ctx context.Context, h http.Header) (context.Context, bool) {
+	if BaggageFromContext(ctx).Len() > 0 {
+		return ctx, false
+	}
+
+	b, err := ExtractBaggage(h)
+	if err != nil || b.Len() == 0 {
+		return ctx, false
+	}
+	return ContextWithBaggage(ctx, b), true
+}
+
+func (BaggagePropagator) Inject(ctx context.Context, h http.Header) {
+	InjectBaggage(ctx, h)
+}
+
+// HeaderPropagator propagates the tracking id on a custom header, such as X-Request-ID.
+// Ids not passing ValidateID are ignored.
+type HeaderPropagator struct {
+	Header string
+	// MaxLength is the maximum accepted id length, defaults to MaxIDLength.
+	MaxLength int
+}
+
+func (p HeaderPropagator) Extract(ctx context.Context, h http.Header) (context.Context, bool) {
+	if IdFromContext(ctx) != "" {
+		return ctx, false
+	}
+
+	id := h.Get(p.Header)
+	if ValidateID(id, p.MaxLength) != nil {
+		return ctx, false
+	}
+	return ContextWithExistingID(ctx, id), true
+}
+
+func (p HeaderPropagator) Inject(ctx context.Context, h http.Header) {
+	if id := IdFromContext(ctx); id != "" {
+		h.Set(p.Header, id)
+	}
+}
@@ -0,0 +1,85 @@
+package tracking
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestPropagatorsExtractFirstWins(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(B3Header, "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1")
+	h.Set("X-Request-ID", "legacy-id")
+	h.Set("X-Correlation-ID", "other-id")
+
+	tcs := []struct {
+		name        string
+		propagators Propagators
+		wantTraceID string
+		wantID      string
+	}{
+		{
+			name:        "trace context first",
+			propagators: Propagators{TraceContextPropagator{}, B3Propagator{}, HeaderPropagator{Header: "X-Request-ID"}},
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantID:      "legacy-id",
+		},
+		{
+			name:        "b3 first",
+			propagators: Propagators{B3Propagator{}, TraceContextPropagator{}, HeaderPropagator{Header: "X-Correlation-ID"}, HeaderPropagator{Header: "X-Request-ID"}},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantID:      "other-id",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, ok := tc.propagators.Extract(context.Background(), h)
+			if !ok {
+				t.Fatal("expected the propagators to find something")
+			}
+
+			if got := TraceIDFromContext(ctx); got != tc.wantTraceID {
+				t.Errorf("want trace-id: %s, got: %s", tc.wantTraceID, got)
+			}
+			if got := IdFromContext(ctx); got != tc.wantID {
+				t.Errorf("want tracking id: %s, got: %s", tc.wantID, got)
+			}
+		})
+	}
+}
+
+func TestPropagatorsInjectAll(t *testing.T) {
+	tc, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := ContextWithTrace(ContextWithExistingID(context.Background(), "some-id"), tc)
+
+	h := http.Header{}
+	Propagators{
+		TraceContextPropagator{},
+		B3Propagator{SingleHeader: true},
+		HeaderPropagator{Header: "X-Request-ID"},
+	}.Inject(ctx, h)
+
+	for _, k := range []string{TraceParentHeader, B3Header, "X-Request-ID"} {
+		if h.Get(k) == "" {
+			t.Errorf("expected %s to be set", k)
+		}
+	}
+}
+
+func TestHeaderPropagatorIgnoresInvalidIDs(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Request-ID", "not valid!")
+
+	ctx, ok := HeaderPropagator{Header: "X-Request-ID"}.Extract(context.Background(), h)
+	if ok {
+		t.Error("expected an invalid id to be ignored")
+	}
+	if id := IdFromContext(ctx); id != "" {
+		t.Errorf("expected no tracking id, got: %s", id)
+	}
+}
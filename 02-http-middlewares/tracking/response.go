@@ -0,0 +1,28 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorBody is the JSON body of error responses, it carries the tracking id so clients can
+// report it back.
+type ErrorBody struct {
+	Error      string `json:"error"`
+	TrackingID string `json:"tracking_id,omitempty"`
+}
+
+// NewErrorBody returns an ErrorBody with msg and the tracking id in ctx.
+func NewErrorBody(ctx context.Context, msg string) ErrorBody {
+	return ErrorBody{Error: msg, TrackingID: IdFromContext(ctx)}
+}
+
+// WriteJSONError replies to r with status and an ErrorBody with msg and the request tracking id.
+func WriteJSONError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(NewErrorBody(r.Context(), msg))
+}
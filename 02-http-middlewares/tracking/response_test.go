@@ -0,0 +1,32 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSONError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r = r.WithContext(ContextWithExistingID(context.Background(), "some-id"))
+	w := httptest.NewRecorder()
+
+	WriteJSONError(w, r, http.StatusNotFound, "user not found")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status: %d, got: %d", http.StatusNotFound, w.Code)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/json; charset=utf-8"; got != want {
+		t.Errorf("want Content-Type: %s, got: %s", want, got)
+	}
+
+	var body ErrorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", w.Body, err)
+	}
+	if want := (ErrorBody{Error: "user not found", TrackingID: "some-id"}); body != want {
+		t.Errorf("want: %+v, got: %+v", want, body)
+	}
+}
@@ -0,0 +1,122 @@
+package tracking
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// Sampler decides whether a trace is sampled, that is, whether its spans are recorded and
+// verbose logs are written. The decision is made once, when the trace context is created,
+// and propagated downstream on the trace flags.
+type Sampler interface {
+	// ShouldSample decides for tc. hasParent is true when tc continues an upstream trace,
+	// then tc.Flags carries the upstream decision.
+	ShouldSample(tc TraceContext, hasParent bool) bool
+}
+
+// SamplerFunc is an adapter to allow the use of ordinary functions as Sampler.
+type SamplerFunc func(tc TraceContext, hasParent bool) bool
+
+// ShouldSample calls f(tc, hasParent).
+func (f SamplerFunc) ShouldSample(tc TraceContext, hasParent bool) bool {
+	return f(tc, hasParent)
+}
+
+// DefaultSampler is the Sampler used when none is configured, it follows the upstream
+// decision and samples all new traces.
+var DefaultSampler Sampler = ParentBased(AlwaysSample())
+
+// AlwaysSample returns a Sampler which samples every trace.
+func AlwaysSample() Sampler {
+	return SamplerFunc(func(TraceContext, bool) bool { return true })
+}
+
+// NeverSample returns a Sampler which samples no trace.
+func NeverSample() Sampler {
+	return SamplerFunc(func(TraceContext, bool) bool { return false })
+}
+
+// RatioSampler returns a Sampler which samples the given ratio, in [0, 1], of the traces. The
+// decision is derived from the trace id, so all services using the same ratio agree on it.
+func RatioSampler(ratio float64) Sampler {
+	if ratio >= 1 {
+		return AlwaysSample()
+	}
+	if ratio <= 0 {
+		return NeverSample()
+	}
+
+	bound := uint64(ratio * (1 << 63))
+	return SamplerFunc(func(tc TraceContext, _ bool) bool {
+		return binary.BigEndian.Uint64(tc.TraceID[8:])>>1 < bound
+	})
+}
+
+// ParentBased returns a Sampler which follows the upstream decision and uses root for new traces.
+func ParentBased(root Sampler) Sampler {
+	return SamplerFunc(func(tc TraceContext, hasParent bool) bool {
+		if hasParent {
+			return tc.Flags.Sampled()
+		}
+		return root.ShouldSample(tc, hasParent)
+	})
+}
+
+// RateLimitedSampler samples at most PerSecond traces per second, with bursts up to PerSecond,
+// or 1 if PerSecond is lower, e.g. 0.1 samples a trace every 10 seconds.
+type RateLimitedSampler struct {
+	perSecond float64
+	burst     float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewRateLimitedSampler returns a RateLimitedSampler sampling up to perSecond traces per second.
+// A rate of zero or less samples no trace.
+func NewRateLimitedSampler(perSecond float64) *RateLimitedSampler {
+	if !(perSecond > 0) {
+		return &RateLimitedSampler{now: time.Now}
+	}
+
+	burst := math.Max(perSecond, 1)
+	return &RateLimitedSampler{perSecond: perSecond, burst: burst, tokens: burst, now: time.Now}
+}
+
+func (s *RateLimitedSampler) ShouldSample(TraceContext, bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if !s.last.IsZero() {
+		s.tokens += now.Sub(s.last).Seconds() * s.perSecond
+		if s.tokens > s.burst {
+			s.tokens = s.burst
+		}
+	}
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// ContextWithSamplingDecision returns a copy of ctx with the trace context sampled flag set by s.
+// hasParent tells whether the trace context in ctx continues an upstream trace. It returns ctx
+// unchanged if it has no trace context.
+func ContextWithSamplingDecision(ctx context.Context, s Sampler, hasParent bool) context.Context {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	tc.Flags = tc.Flags.WithSampled(s.ShouldSample(tc, hasParent))
+	return ContextWithTrace(ctx, tc)
+}
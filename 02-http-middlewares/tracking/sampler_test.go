@@ -0,0 +1,165 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRatioSampler(t *testing.T) {
+	tcs := []struct {
+		ratio   float64
+		wantMin int
+		wantMax int
+	}{
+		{ratio: 0, wantMin: 0, wantMax: 0},
+		{ratio: 0.25, wantMin: 200, wantMax: 300},
+		{ratio: 1, wantMin: 1000, wantMax: 1000},
+	}
+
+	for _, tc := range tcs {
+		s := RatioSampler(tc.ratio)
+
+		var sampled int
+		for i := 0; i < 1000; i++ {
+			trace, err := NewTraceContext()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.ShouldSample(trace, false) {
+				sampled++
+			}
+		}
+
+		if sampled < tc.wantMin || sampled > tc.wantMax {
+			t.Errorf("ratio %v: want between %d and %d sampled, got: %d", tc.ratio, tc.wantMin, tc.wantMax, sampled)
+		}
+	}
+}
+
+func TestRatioSamplerIsDeterministic(t *testing.T) {
+	s := RatioSampler(0.5)
+	trace, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := s.ShouldSample(trace, false)
+	for i := 0; i < 10; i++ {
+		if got := s.ShouldSample(trace, false); got != want {
+			t.Fatalf("want the same decision for the same trace id: %t, got: %t", want, got)
+		}
+	}
+}
+
+func TestParentBased(t *testing.T) {
+	s := ParentBased(NeverSample())
+
+	if !s.ShouldSample(TraceContext{Flags: FlagSampled}, true) {
+		t.Error("expected a sampled parent to be followed")
+	}
+	if s.ShouldSample(TraceContext{}, true) {
+		t.Error("expected a not sampled parent to be followed")
+	}
+	if s.ShouldSample(TraceContext{Flags: FlagSampled}, false) {
+		t.Error("expected the root sampler to decide for new traces")
+	}
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewRateLimitedSampler(2)
+	s.now = func() time.Time { return now }
+
+	want := []bool{true, true, false}
+	for i, w := range want {
+		if got := s.ShouldSample(TraceContext{}, false); got != w {
+			t.Errorf("call %d: want: %t, got: %t", i, w, got)
+		}
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !s.ShouldSample(TraceContext{}, false) {
+		t.Error("expected a token to be available after 500ms")
+	}
+	if s.ShouldSample(TraceContext{}, false) {
+		t.Error("expected no token to be available")
+	}
+}
+
+func TestRateLimitedSamplerFractionalRate(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewRateLimitedSampler(0.5)
+	s.now = func() time.Time { return now }
+
+	want := []bool{true, false}
+	for i, w := range want {
+		if got := s.ShouldSample(TraceContext{}, false); got != w {
+			t.Errorf("call %d: want: %t, got: %t", i, w, got)
+		}
+	}
+
+	now = now.Add(time.Second)
+	if s.ShouldSample(TraceContext{}, false) {
+		t.Error("expected no token to be available after 1s")
+	}
+	now = now.Add(time.Second)
+	if !s.ShouldSample(TraceContext{}, false) {
+		t.Error("expected a token to be available after 2s")
+	}
+}
+
+func TestRateLimitedSamplerNonPositiveRate(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		s := NewRateLimitedSampler(rate)
+		s.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			if s.ShouldSample(TraceContext{}, false) {
+				t.Errorf("rate %v, call %d: want no trace sampled", rate, i)
+			}
+			now = now.Add(time.Hour)
+		}
+	}
+}
+
+func TestContextWithSamplingDecision(t *testing.T) {
+	trace, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := ContextWithTrace(context.Background(), trace)
+
+	ctx = ContextWithSamplingDecision(ctx, NeverSample(), false)
+	if Sampled(ctx) {
+		t.Error("expected the trace not to be sampled")
+	}
+
+	ctx = ContextWithSamplingDecision(ctx, AlwaysSample(), false)
+	if !Sampled(ctx) {
+		t.Error("expected the trace to be sampled")
+	}
+}
+
+func TestNotSampledSpansAreNotExported(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{Sampler: NeverSample()}, exporter)
+	withTracer(t, tracer)
+
+	ctx, root := StartSpan(context.Background(), "root")
+	_, child := StartSpan(ctx, "child")
+	child.End()
+	root.End()
+
+	if root.Sampled() || child.Sampled() {
+		t.Error("expected the spans not to be sampled")
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := exporter.spans(); len(spans) != 0 {
+		t.Errorf("expected no exported spans, got: %d", len(spans))
+	}
+}
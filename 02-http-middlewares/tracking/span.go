@@ -0,0 +1,197 @@
+package tracking
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StatusCode is the status of a finished Span.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	default:
+		return "unset"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c StatusCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// SpanData is a snapshot of a Span, it's what exporters receive once the span ends.
+type SpanData struct {
+	Name       string                 `json:"name"`
+	TrackingID string                 `json:"tracking_id,omitempty"`
+	TraceID    TraceID                `json:"-"`
+	SpanID     SpanID                 `json:"-"`
+	ParentID   SpanID                 `json:"-"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Status     StatusCode             `json:"status"`
+	// StatusMessage describes the error when Status is StatusError.
+	StatusMessage string `json:"status_message,omitempty"`
+}
+
+// Span is a timed operation within a trace. Its methods are safe for concurrent use and
+// do nothing once the span has ended.
+type Span struct {
+	tracer  *Tracer
+	sampled bool
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type spanKey struct{}
+
+// StartSpan starts a new span as a child of the current span in ctx, or as the root of a new
+// trace if ctx has no TraceContext. The returned context carries the new span and has it
+// as the current span of its TraceContext, so spans started from it and outbound calls made
+// with it are its children. The span is exported to the Tracer set by SetTracer when it ends,
+// if its trace is sampled. New traces are sampled according to the Tracer Sampler.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	tracer := currentTracer()
+	tc, ok := TraceFromContext(ctx)
+
+	var err error
+	if ok {
+		tc, err = tc.NewChild()
+	} else {
+		tc, err = NewTraceContext()
+		tc.Flags = tc.Flags.WithSampled(tracer.sampler().ShouldSample(tc, false))
+	}
+	if err != nil {
+		// not being able to generate random ids should never happen, if it does, the span
+		// takes the place of its parent instead of breaking the request.
+		tc, _ = TraceFromContext(ctx)
+	}
+
+	s := &Span{
+		tracer:  tracer,
+		sampled: tc.Flags.Sampled(),
+		data: SpanData{
+			Name:       name,
+			TrackingID: IdFromContext(ctx),
+			TraceID:    tc.TraceID,
+			SpanID:     tc.SpanID,
+			ParentID:   tc.ParentID,
+			Start:      time.Now(),
+		},
+	}
+
+	ctx = ContextWithTrace(ctx, tc)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext returns the current span in ctx or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// TraceID returns the span trace id.
+func (s *Span) TraceID() TraceID {
+	return s.data.TraceID
+}
+
+// SpanID returns the span id.
+func (s *Span) SpanID() SpanID {
+	return s.data.SpanID
+}
+
+// Sampled reports whether the span trace is sampled, only sampled spans are exported.
+func (s *Span) Sampled() bool {
+	return s.sampled
+}
+
+// ParentID returns the parent span id, it's zero for a root span.
+func (s *Span) ParentID() SpanID {
+	return s.data.ParentID
+}
+
+// SetAttribute sets the attribute key to value. Values should be strings, booleans or numbers.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]interface{}{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetStatus sets the span status, msg is only kept for StatusError.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	s.data.Status = code
+	s.data.StatusMessage = ""
+	if code == StatusError {
+		s.data.StatusMessage = msg
+	}
+}
+
+// RecordError sets the span status to StatusError with err as the message, a nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End ends the span and queues it to be exported. Only the first call has any effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.snapshot()
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// Data returns a snapshot of the span.
+func (s *Span) Data() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot()
+}
+
+func (s *Span) snapshot() SpanData {
+	data := s.data
+	if s.data.Attributes != nil {
+		data.Attributes = make(map[string]interface{}, len(s.data.Attributes))
+		for k, v := range s.data.Attributes {
+			data.Attributes[k] = v
+		}
+	}
+	return data
+}
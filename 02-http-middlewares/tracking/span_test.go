@@ -0,0 +1,236 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type memoryExporter struct {
+	mu       sync.Mutex
+	batches  [][]SpanData
+	shutdown bool
+}
+
+func (e *memoryExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.batches = append(e.batches, append([]SpanData(nil), spans...))
+	return nil
+}
+
+func (e *memoryExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.shutdown = true
+	return nil
+}
+
+func (e *memoryExporter) spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var spans []SpanData
+	for _, b := range e.batches {
+		spans = append(spans, b...)
+	}
+	return spans
+}
+
+// exporterFunc is an Exporter calling itself to export the spans.
+type exporterFunc func(spans []SpanData) error
+
+func (f exporterFunc) ExportSpans(spans []SpanData) error { return f(spans) }
+
+func (f exporterFunc) Shutdown() error { return nil }
+
+func withTracer(t *testing.T, tracer *Tracer) {
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx := ContextWithExistingID(context.Background(), "some-id")
+
+	ctx, root := StartSpan(ctx, "root")
+	if root.ParentID().IsValid() {
+		t.Errorf("expected the root span to have no parent, got: %s", root.ParentID())
+	}
+	if SpanFromContext(ctx) != root {
+		t.Error("expected the root span to be in the context")
+	}
+
+	childCtx, child := StartSpan(ctx, "child")
+	if child.TraceID() != root.TraceID() {
+		t.Errorf("want trace-id: %s, got: %s", root.TraceID(), child.TraceID())
+	}
+	if child.ParentID() != root.SpanID() {
+		t.Errorf("want parent-id: %s, got: %s", root.SpanID(), child.ParentID())
+	}
+	if got := SpanIDFromContext(childCtx); got != child.SpanID().String() {
+		t.Errorf("want current span id: %s, got: %s", child.SpanID(), got)
+	}
+	if got := child.Data().TrackingID; got != "some-id" {
+		t.Errorf("want tracking id: some-id, got: %s", got)
+	}
+}
+
+func TestStartSpanContinuesTrace(t *testing.T) {
+	tc, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, s := StartSpan(ContextWithTrace(context.Background(), tc), "span")
+
+	if s.TraceID() != tc.TraceID {
+		t.Errorf("want trace-id: %s, got: %s", tc.TraceID, s.TraceID())
+	}
+	if s.ParentID() != tc.SpanID {
+		t.Errorf("want parent-id: %s, got: %s", tc.SpanID, s.ParentID())
+	}
+}
+
+func TestSpanEnd(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{}, exporter)
+	withTracer(t, tracer)
+
+	_, s := StartSpan(context.Background(), "span")
+	s.SetAttribute("user.id", 42)
+	s.RecordError(errors.New("boom"))
+	s.End()
+
+	// no effect after End
+	s.SetAttribute("ignored", true)
+	s.SetStatus(StatusOK, "")
+	s.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := exporter.spans()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got: %d", len(spans))
+	}
+
+	got := spans[0]
+	if got.Name != "span" {
+		t.Errorf("want name: span, got: %s", got.Name)
+	}
+	if got.Status != StatusError || got.StatusMessage != "boom" {
+		t.Errorf("want status: error boom, got: %s %s", got.Status, got.StatusMessage)
+	}
+	if len(got.Attributes) != 1 || got.Attributes["user.id"] != 42 {
+		t.Errorf("want attributes: map[user.id:42], got: %v", got.Attributes)
+	}
+	if got.End.Before(got.Start) {
+		t.Errorf("expected end %s to be after start %s", got.End, got.Start)
+	}
+	if !exporter.shutdown {
+		t.Error("expected the exporter to be shut down")
+	}
+}
+
+func TestTracerBatches(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{BatchSize: 2, FlushInterval: time.Hour}, exporter)
+	withTracer(t, tracer)
+
+	for i := 0; i < 5; i++ {
+		_, s := StartSpan(context.Background(), "span")
+		s.End()
+	}
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exporter.mu.Lock()
+	var sizes []int
+	for _, b := range exporter.batches {
+		sizes = append(sizes, len(b))
+	}
+	exporter.mu.Unlock()
+
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("want batches of [2 2 1], got: %v", sizes)
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != ErrTracerShutdown {
+		t.Errorf("want: %v, got: %v", ErrTracerShutdown, err)
+	}
+}
+
+func TestTracerLogsExportErrors(t *testing.T) {
+	logs := &bytes.Buffer{}
+	exporter := exporterFunc(func(spans []SpanData) error { return errors.New("collector down") })
+	tracer := NewTracer(TracerConfig{FlushInterval: time.Hour, Logger: zerolog.New(logs)}, exporter)
+	withTracer(t, tracer)
+
+	_, s := StartSpan(context.Background(), "span")
+	s.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"level":"error","error":"collector down","message":"could not export spans"}` + "\n"
+	if got := logs.String(); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestTracerLogsExportErrorsToStderr(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create pipe: %v", err)
+	}
+	defer r.Close()
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	exporter := exporterFunc(func(spans []SpanData) error { return errors.New("collector down") })
+	tracer := NewTracer(TracerConfig{FlushInterval: time.Hour}, exporter)
+	withTracer(t, tracer)
+
+	_, s := StartSpan(context.Background(), "span")
+	s.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.Close()
+
+	logs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("could not read stderr: %v", err)
+	}
+	if !strings.Contains(string(logs), `"error":"collector down"`) {
+		t.Errorf("want the export error logged to stderr, got: %s", logs)
+	}
+}
+
+func TestTracerDropsWhenQueueIsFull(t *testing.T) {
+	tracer := &Tracer{queue: make(chan SpanData, 1)}
+
+	tracer.enqueue(SpanData{})
+	tracer.enqueue(SpanData{})
+
+	if got := tracer.Dropped(); got != 1 {
+		t.Errorf("want 1 dropped span, got: %d", got)
+	}
+}
@@ -0,0 +1,453 @@
+package tracking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+const (
+	maxTraceStateMembers = 32
+	maxTraceStateLength  = 512
+)
+
+var (
+	ErrNoTraceParent      = errors.New("traceparent header not present")
+	ErrInvalidTraceParent = errors.New("invalid traceparent")
+	ErrInvalidTraceState  = errors.New("invalid tracestate")
+)
+
+// TraceID is the W3C trace-id, it identifies a whole distributed trace.
+type TraceID [16]byte
+
+// IsValid reports whether t is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID is the W3C parent-id, it identifies an operation, a span, within a trace.
+type SpanID [8]byte
+
+// IsValid reports whether s is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// TraceFlags are the W3C trace-flags.
+type TraceFlags byte
+
+// FlagSampled is the trace-flags bit telling the caller may have recorded the trace.
+const FlagSampled TraceFlags = 0x01
+
+// Sampled reports whether the sampled flag is set.
+func (f TraceFlags) Sampled() bool {
+	return f&FlagSampled == FlagSampled
+}
+
+// WithSampled returns f with the sampled flag set or cleared.
+func (f TraceFlags) WithSampled(sampled bool) TraceFlags {
+	if sampled {
+		return f | FlagSampled
+	}
+	return f &^ FlagSampled
+}
+
+// TraceParent is a parsed traceparent header.
+type TraceParent struct {
+	Version  byte
+	TraceID  TraceID
+	ParentID SpanID
+	Flags    TraceFlags
+}
+
+// ParseTraceParent parses and validates a traceparent header value. Versions higher than 00 are
+// parsed following the spec forward compatibility rules.
+func ParseTraceParent(s string) (TraceParent, error) {
+	s = strings.TrimSpace(s)
+	// version(2) - trace-id(32) - parent-id(16) - flags(2)
+	if len(s) < 55 {
+		return TraceParent{}, fmt.Errorf("%w: %q is too short", ErrInvalidTraceParent, s)
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return TraceParent{}, fmt.Errorf("%w: %q is malformed", ErrInvalidTraceParent, s)
+	}
+
+	var tp TraceParent
+
+	var version [1]byte
+	if err := decodeLowerHex(version[:], s[0:2]); err != nil || version[0] == 0xff {
+		return TraceParent{}, fmt.Errorf("%w: invalid version %q", ErrInvalidTraceParent, s[0:2])
+	}
+	tp.Version = version[0]
+
+	if tp.Version == 0 && len(s) != 55 {
+		return TraceParent{}, fmt.Errorf("%w: %q has trailing data", ErrInvalidTraceParent, s)
+	}
+	if tp.Version > 0 && len(s) > 55 && s[55] != '-' {
+		return TraceParent{}, fmt.Errorf("%w: %q is malformed", ErrInvalidTraceParent, s)
+	}
+
+	if err := decodeLowerHex(tp.TraceID[:], s[3:35]); err != nil || !tp.TraceID.IsValid() {
+		return TraceParent{}, fmt.Errorf("%w: invalid trace-id %q", ErrInvalidTraceParent, s[3:35])
+	}
+	if err := decodeLowerHex(tp.ParentID[:], s[36:52]); err != nil || !tp.ParentID.IsValid() {
+		return TraceParent{}, fmt.Errorf("%w: invalid parent-id %q", ErrInvalidTraceParent, s[36:52])
+	}
+
+	var flags [1]byte
+	if err := decodeLowerHex(flags[:], s[53:55]); err != nil {
+		return TraceParent{}, fmt.Errorf("%w: invalid trace-flags %q", ErrInvalidTraceParent, s[53:55])
+	}
+	tp.Flags = TraceFlags(flags[0])
+
+	return tp, nil
+}
+
+// String returns tp encoded as a version 00 traceparent header value.
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceID, tp.ParentID, byte(tp.Flags))
+}
+
+func decodeLowerHex(dst []byte, s string) error {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return hex.InvalidByteError(c)
+		}
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+type traceStateMember struct {
+	key   string
+	value string
+}
+
+// TraceState is a parsed tracestate header. The zero value is an empty TraceState.
+// TraceState is immutable, the methods modifying it return a copy.
+type TraceState struct {
+	members []traceStateMember
+}
+
+// ParseTraceState parses and validates a tracestate header value.
+func ParseTraceState(s string) (TraceState, error) {
+	var ts TraceState
+
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+
+		i := strings.IndexByte(m, '=')
+		if i < 0 {
+			return TraceState{}, fmt.Errorf("%w: member %q has no '='", ErrInvalidTraceState, m)
+		}
+
+		k, v := m[:i], m[i+1:]
+		if !validTraceStateKey(k) {
+			return TraceState{}, fmt.Errorf("%w: invalid key %q", ErrInvalidTraceState, k)
+		}
+		if !validTraceStateValue(v) {
+			return TraceState{}, fmt.Errorf("%w: invalid value %q", ErrInvalidTraceState, v)
+		}
+		if _, ok := ts.Get(k); ok {
+			return TraceState{}, fmt.Errorf("%w: duplicated key %q", ErrInvalidTraceState, k)
+		}
+
+		ts.members = append(ts.members, traceStateMember{key: k, value: v})
+	}
+
+	if len(ts.members) > maxTraceStateMembers {
+		return TraceState{}, fmt.Errorf("%w: more than %d members", ErrInvalidTraceState, maxTraceStateMembers)
+	}
+
+	return ts, nil
+}
+
+// Get returns the value of key.
+func (ts TraceState) Get(key string) (string, bool) {
+	for _, m := range ts.members {
+		if m.key == key {
+			return m.value, true
+		}
+	}
+	return "", false
+}
+
+// Insert returns a copy of ts with key set to value as its first member, as required
+// by the spec when a vendor updates its own entry.
+func (ts TraceState) Insert(key, value string) (TraceState, error) {
+	if !validTraceStateKey(key) {
+		return ts, fmt.Errorf("%w: invalid key %q", ErrInvalidTraceState, key)
+	}
+	if !validTraceStateValue(value) {
+		return ts, fmt.Errorf("%w: invalid value %q", ErrInvalidTraceState, value)
+	}
+
+	members := make([]traceStateMember, 0, len(ts.members)+1)
+	members = append(members, traceStateMember{key: key, value: value})
+	for _, m := range ts.members {
+		if m.key != key {
+			members = append(members, m)
+		}
+	}
+	if len(members) > maxTraceStateMembers {
+		members = members[:maxTraceStateMembers]
+	}
+
+	return TraceState{members: members}, nil
+}
+
+// Delete returns a copy of ts without key.
+func (ts TraceState) Delete(key string) TraceState {
+	members := make([]traceStateMember, 0, len(ts.members))
+	for _, m := range ts.members {
+		if m.key != key {
+			members = append(members, m)
+		}
+	}
+	return TraceState{members: members}
+}
+
+// Len returns the number of members in ts.
+func (ts TraceState) Len() int {
+	return len(ts.members)
+}
+
+// String returns ts encoded as a tracestate header value. Members are dropped from the end
+// until it fits the 512 bytes the spec asks propagators to keep.
+func (ts TraceState) String() string {
+	var b strings.Builder
+	for _, m := range ts.members {
+		n := len(m.key) + 1 + len(m.value)
+		if b.Len() > 0 {
+			n++
+		}
+		if b.Len()+n > maxTraceStateLength {
+			break
+		}
+
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(m.key)
+		b.WriteByte('=')
+		b.WriteString(m.value)
+	}
+	return b.String()
+}
+
+func validTraceStateKey(k string) bool {
+	if i := strings.IndexByte(k, '@'); i >= 0 {
+		tenant, system := k[:i], k[i+1:]
+		return len(tenant) >= 1 && len(tenant) <= 241 && isTraceStateKeyChars(tenant, true) &&
+			len(system) >= 1 && len(system) <= 14 && isTraceStateKeyChars(system, false)
+	}
+
+	return len(k) >= 1 && len(k) <= 256 && isTraceStateKeyChars(k, false)
+}
+
+func isTraceStateKeyChars(s string, digitFirst bool) bool {
+	first := s[0]
+	if !('a' <= first && first <= 'z' || digitFirst && '0' <= first && first <= '9') {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '*' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+func validTraceStateValue(v string) bool {
+	if len(v) == 0 || len(v) > 256 || v[len(v)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceContext is the W3C trace context of the current request.
+type TraceContext struct {
+	TraceID TraceID
+	// SpanID identifies the current operation, it's sent downstream as the traceparent parent-id.
+	SpanID SpanID
+	// ParentID is the upstream caller span id, it's zero for a trace started by us.
+	ParentID SpanID
+	Flags    TraceFlags
+	State    TraceState
+}
+
+// NewTraceContext starts a new sampled trace with random trace and span ids.
+func NewTraceContext() (TraceContext, error) {
+	var tc TraceContext
+
+	if err := randomID(tc.TraceID[:]); err != nil {
+		return TraceContext{}, fmt.Errorf("could not generate trace-id: %w", err)
+	}
+	if err := randomID(tc.SpanID[:]); err != nil {
+		return TraceContext{}, fmt.Errorf("could not generate span-id: %w", err)
+	}
+	tc.Flags = FlagSampled
+
+	return tc, nil
+}
+
+// ContinueTraceContext returns a TraceContext continuing the trace described by tp, with
+// tp.ParentID as the parent and a new random span id.
+func ContinueTraceContext(tp TraceParent, ts TraceState) (TraceContext, error) {
+	tc := TraceContext{
+		TraceID:  tp.TraceID,
+		ParentID: tp.ParentID,
+		Flags:    tp.Flags,
+		State:    ts,
+	}
+
+	if err := randomID(tc.SpanID[:]); err != nil {
+		return TraceContext{}, fmt.Errorf("could not generate span-id: %w", err)
+	}
+
+	return tc, nil
+}
+
+// NewChild returns a TraceContext for a child operation of tc: same trace, tc.SpanID as the
+// parent and a new random span id.
+func (tc TraceContext) NewChild() (TraceContext, error) {
+	child := tc
+	child.ParentID = tc.SpanID
+
+	if err := randomID(child.SpanID[:]); err != nil {
+		return TraceContext{}, fmt.Errorf("could not generate span-id: %w", err)
+	}
+
+	return child, nil
+}
+
+// TraceParent returns the traceparent to send to downstream services.
+func (tc TraceContext) TraceParent() TraceParent {
+	return TraceParent{TraceID: tc.TraceID, ParentID: tc.SpanID, Flags: tc.Flags}
+}
+
+// ExtractTraceContext reads the traceparent and tracestate headers from h and continues the
+// trace they describe. An invalid tracestate is discarded as the spec requires.
+func ExtractTraceContext(h http.Header) (TraceContext, error) {
+	values := h.Values(TraceParentHeader)
+	if len(values) == 0 {
+		return TraceContext{}, ErrNoTraceParent
+	}
+	if len(values) > 1 {
+		return TraceContext{}, fmt.Errorf("%w: multiple traceparent headers", ErrInvalidTraceParent)
+	}
+
+	tp, err := ParseTraceParent(values[0])
+	if err != nil {
+		return TraceContext{}, err
+	}
+
+	ts, err := ParseTraceState(strings.Join(h.Values(TraceStateHeader), ","))
+	if err != nil {
+		ts = TraceState{}
+	}
+
+	return ContinueTraceContext(tp, ts)
+}
+
+// InjectTraceContext writes the trace context in ctx, if any, to h as traceparent and tracestate headers.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	h.Set(TraceParentHeader, tc.TraceParent().String())
+	if ts := tc.State.String(); ts != "" {
+		h.Set(TraceStateHeader, ts)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+}
+
+type traceKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying tc.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// TraceFromContext returns the TraceContext carried by ctx.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// TraceIDFromContext returns the hex encoded trace-id carried by ctx or an empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	if tc, ok := TraceFromContext(ctx); ok {
+		return tc.TraceID.String()
+	}
+	return ""
+}
+
+// SpanIDFromContext returns the hex encoded id of the current span or an empty string.
+func SpanIDFromContext(ctx context.Context) string {
+	if tc, ok := TraceFromContext(ctx); ok {
+		return tc.SpanID.String()
+	}
+	return ""
+}
+
+// ParentIDFromContext returns the hex encoded upstream parent-id or an empty string if there is none.
+func ParentIDFromContext(ctx context.Context) string {
+	if tc, ok := TraceFromContext(ctx); ok && tc.ParentID.IsValid() {
+		return tc.ParentID.String()
+	}
+	return ""
+}
+
+// Sampled reports whether the trace carried by ctx is sampled, see Sampler.
+func Sampled(ctx context.Context) bool {
+	tc, ok := TraceFromContext(ctx)
+	return ok && tc.Flags.Sampled()
+}
+
+func randomID(b []byte) error {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+
+		for _, c := range b {
+			if c != 0 {
+				return nil
+			}
+		}
+	}
+}
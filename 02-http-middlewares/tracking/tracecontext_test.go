@@ -0,0 +1,172 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tcs := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "valid sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "valid not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "future version with extra data", value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds"},
+		{name: "empty", value: "", wantErr: true},
+		{name: "version ff", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "version 00 with extra data", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "upper case", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero trace-id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero parent-id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "wrong separator", value: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "invalid flags", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g", wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tp, err := ParseTraceParent(tc.value)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidTraceParent) {
+					t.Errorf("want: %v, got: %v", ErrInvalidTraceParent, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got, want := tp.TraceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736"; got != want {
+				t.Errorf("want trace-id: %s, got: %s", want, got)
+			}
+			if got, want := tp.ParentID.String(), "00f067aa0ba902b7"; got != want {
+				t.Errorf("want parent-id: %s, got: %s", want, got)
+			}
+		})
+	}
+}
+
+func TestTraceParentString(t *testing.T) {
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tp, err := ParseTraceParent(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := tp.String(); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestParseTraceState(t *testing.T) {
+	tcs := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: ""},
+		{name: "single member", value: "congo=t61rcWkgMzE", want: "congo=t61rcWkgMzE"},
+		{name: "multiple members with spaces", value: "rojo=00f067aa0ba902b7 , congo=t61rcWkgMzE", want: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		{name: "multi tenant key", value: "fw529a3039@dt=FUALAB", want: "fw529a3039@dt=FUALAB"},
+		{name: "empty members are skipped", value: "a=1,,b=2", want: "a=1,b=2"},
+		{name: "no equals", value: "congo", wantErr: true},
+		{name: "upper case key", value: "Congo=1", wantErr: true},
+		{name: "duplicated key", value: "a=1,a=2", wantErr: true},
+		{name: "value with trailing space", value: "a=1 ,b=2 x", want: "a=1,b=2 x"},
+		{name: "value with equals", value: "a=1=2", wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, err := ParseTraceState(tc.value)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidTraceState) {
+					t.Errorf("want: %v, got: %v", ErrInvalidTraceState, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := ts.String(); got != tc.want {
+				t.Errorf("want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTraceStateInsert(t *testing.T) {
+	ts, err := ParseTraceState("a=1,b=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts, err = ts.Insert("b", "3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := ts.String(), "b=3,a=1"; got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestExtractInjectTraceContext(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	h := http.Header{}
+	h.Set(TraceParentHeader, traceparent)
+	h.Set(TraceStateHeader, "congo=t61rcWkgMzE")
+
+	tc, err := ExtractTraceContext(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := ContextWithTrace(context.Background(), tc)
+	if got, want := TraceIDFromContext(ctx), "4bf92f3577b34da6a3ce929d0e0e4736"; got != want {
+		t.Errorf("want trace-id: %s, got: %s", want, got)
+	}
+	if got, want := ParentIDFromContext(ctx), "00f067aa0ba902b7"; got != want {
+		t.Errorf("want parent-id: %s, got: %s", want, got)
+	}
+	if !Sampled(ctx) {
+		t.Error("expected the trace to be sampled")
+	}
+
+	out := http.Header{}
+	InjectTraceContext(ctx, out)
+
+	tp, err := ParseTraceParent(out.Get(TraceParentHeader))
+	if err != nil {
+		t.Fatalf("unexpected error parsing injected traceparent: %v", err)
+	}
+	if tp.TraceID != tc.TraceID {
+		t.Errorf("want trace-id: %s, got: %s", tc.TraceID, tp.TraceID)
+	}
+	if tp.ParentID != tc.SpanID {
+		t.Errorf("want parent-id: %s, got: %s", tc.SpanID, tp.ParentID)
+	}
+	if got, want := out.Get(TraceStateHeader), "congo=t61rcWkgMzE"; got != want {
+		t.Errorf("want tracestate: %s, got: %s", want, got)
+	}
+}
+
+func TestExtractTraceContextInvalidTraceState(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TraceStateHeader, "not a valid tracestate")
+
+	tc, err := ExtractTraceContext(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tc.State.Len() != 0 {
+		t.Errorf("expected the invalid tracestate to be discarded, got: %s", tc.State)
+	}
+}
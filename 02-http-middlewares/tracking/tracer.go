@@ -0,0 +1,241 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	tracerMu     sync.RWMutex
+	globalTracer *Tracer
+)
+
+// SetTracer sets the Tracer spans started from now on are exported to. A nil t discards them.
+func SetTracer(t *Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+
+	globalTracer = t
+}
+
+func currentTracer() *Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+
+	return globalTracer
+}
+
+// TracerConfig configures a Tracer.
+type TracerConfig struct {
+	// BatchSize is the maximum number of spans sent to the exporters at once, defaults to 512.
+	BatchSize int
+	// FlushInterval is the maximum time a span waits before being exported, defaults to 5s.
+	FlushInterval time.Duration
+	// QueueSize is how many ended spans can wait to be exported, spans ended while the queue
+	// is full are dropped. Defaults to 2048.
+	QueueSize int
+	// ErrorHandler is called with the errors returned by the exporters, defaults to log them
+	// to Logger.
+	ErrorHandler func(error)
+	// Logger the exporter errors are logged to if there is no ErrorHandler, e.g. config.Logger().
+	// Defaults to a logger writing to stderr.
+	Logger zerolog.Logger
+	// Sampler decides whether the traces started by StartSpan, the ones without a parent, are
+	// sampled. Defaults to DefaultSampler.
+	Sampler Sampler
+}
+
+// ErrTracerShutdown is returned when a Tracer is shut down more than once.
+var ErrTracerShutdown = errors.New("tracer already shut down")
+
+// Tracer batches ended spans and sends them to its exporters on a background goroutine.
+type Tracer struct {
+	cfg       TracerConfig
+	exporters []Exporter
+
+	queue   chan SpanData
+	flush   chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu       sync.RWMutex
+	shutdown bool
+	dropped  uint64
+}
+
+// NewTracer returns a running Tracer exporting to exporters. Call Shutdown to flush the
+// pending spans and release the exporters.
+func NewTracer(cfg TracerConfig, exporters ...Exporter) *Tracer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 2048
+	}
+	if cfg.Sampler == nil {
+		cfg.Sampler = DefaultSampler
+	}
+	if cfg.ErrorHandler == nil {
+		logger := cfg.Logger
+		// the zero Logger writes nowhere, the errors would be lost
+		if reflect.ValueOf(logger).IsZero() {
+			logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		}
+		cfg.ErrorHandler = func(err error) {
+			logger.Error().Err(err).Msg("could not export spans")
+		}
+	}
+
+	t := &Tracer{
+		cfg:       cfg,
+		exporters: exporters,
+		queue:     make(chan SpanData, cfg.QueueSize),
+		flush:     make(chan chan struct{}),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go t.run()
+
+	return t
+}
+
+// Dropped returns how many spans were dropped because the queue was full.
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Flush exports all queued spans, it blocks until they are exported or ctx is done.
+func (t *Tracer) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case t.flush <- flushed:
+	case <-t.stopped:
+		return ErrTracerShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans and shuts the exporters down. Spans ended after
+// Shutdown are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if t.shutdown {
+		t.mu.Unlock()
+		return ErrTracerShutdown
+	}
+	t.shutdown = true
+	close(t.done)
+	t.mu.Unlock()
+
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var firstErr error
+	for _, e := range t.exporters {
+		if err := e.Shutdown(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *Tracer) sampler() Sampler {
+	if t == nil {
+		return DefaultSampler
+	}
+	return t.cfg.Sampler
+}
+
+func (t *Tracer) enqueue(s SpanData) {
+	if t == nil {
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.shutdown {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+
+	select {
+	case t.queue <- s:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.cfg.BatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for _, e := range t.exporters {
+			if err := e.ExportSpans(batch); err != nil {
+				t.cfg.ErrorHandler(err)
+			}
+		}
+		batch = make([]SpanData, 0, t.cfg.BatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-t.queue:
+				batch = append(batch, s)
+				if len(batch) == t.cfg.BatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) == t.cfg.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-t.flush:
+			drain()
+			close(flushed)
+		case <-t.done:
+			drain()
+			return
+		}
+	}
+}
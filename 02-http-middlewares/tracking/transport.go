@@ -0,0 +1,121 @@
+package tracking
+
+import (
+	"net/http"
+	"time"
+)
+
+// ClientEvent describes an outbound http call made through Transport.
+type ClientEvent struct {
+	TrackingID string
+	// TraceID, SpanID and ParentID are empty if the request context has no TraceContext.
+	// SpanID identifies the outbound call, its parent is the span which made the call.
+	TraceID  string
+	SpanID   string
+	ParentID string
+
+	Method     string
+	URL        string
+	StatusCode int
+	Start      time.Time
+	Duration   time.Duration
+	Err        error
+}
+
+// Transport is a http.RoundTripper which propagates the tracking id, the trace context and
+// the baggage from the request context to the outbound request headers.
+type Transport struct {
+	// Base is the RoundTripper used to make the requests, defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	// Headers the tracking id is written to, defaults to Header.
+	Headers []string
+	// Propagators write the trace context and baggage, defaults to DefaultPropagators.
+	Propagators Propagators
+	// Record, if not nil, is called once each request finishes, with the outbound call as a
+	// child event of the current trace.
+	Record func(ClientEvent)
+}
+
+// NewClient returns a copy of c, or of a zero http.Client if c is nil, using t wrapping c's transport.
+func NewClient(c *http.Client, t Transport) *http.Client {
+	var client http.Client
+	if c != nil {
+		client = *c
+	}
+
+	if t.Base == nil {
+		t.Base = client.Transport
+	}
+	client.Transport = &t
+
+	return &client
+}
+
+// RoundTrip implements http.RoundTripper. It does not modify r, the headers are set on a copy of it.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	out := r.Clone(ctx)
+
+	ev := ClientEvent{
+		TrackingID: IdFromContext(ctx),
+		Method:     out.Method,
+		URL:        out.URL.String(),
+	}
+
+	if ev.TrackingID != "" {
+		for _, h := range t.headers() {
+			out.Header.Set(h, ev.TrackingID)
+		}
+	}
+
+	if tc, ok := TraceFromContext(ctx); ok {
+		// if no child span can be created, propagate the current one
+		if child, err := tc.NewChild(); err == nil {
+			tc = child
+		}
+		ctx = ContextWithTrace(ctx, tc)
+
+		ev.TraceID = tc.TraceID.String()
+		ev.SpanID = tc.SpanID.String()
+		if tc.ParentID.IsValid() {
+			ev.ParentID = tc.ParentID.String()
+		}
+	}
+
+	t.propagators().Inject(ctx, out.Header)
+
+	ev.Start = time.Now()
+	resp, err := t.base().RoundTrip(out)
+	ev.Duration = time.Since(ev.Start)
+
+	if t.Record != nil {
+		ev.Err = err
+		if resp != nil {
+			ev.StatusCode = resp.StatusCode
+		}
+		t.Record(ev)
+	}
+
+	return resp, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) propagators() Propagators {
+	if t.Propagators != nil {
+		return t.Propagators
+	}
+	return DefaultPropagators()
+}
+
+func (t *Transport) headers() []string {
+	if len(t.Headers) > 0 {
+		return t.Headers
+	}
+	return []string{Header}
+}
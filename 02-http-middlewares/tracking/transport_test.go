@@ -0,0 +1,103 @@
+package tracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	tc, err := NewTraceContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := ContextWithTrace(ContextWithExistingID(context.Background(), "some-id"), tc)
+	if ctx, err = BaggageKey("tenant").Set(ctx, "acme"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var events []ClientEvent
+	client := NewClient(nil, Transport{
+		Headers: []string{Header, "X-Request-ID"},
+		Record:  func(ev ClientEvent) { events = append(events, ev) },
+	})
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, h := range []string{Header, "X-Request-ID"} {
+		if v := got.Get(h); v != "some-id" {
+			t.Errorf("want %s: some-id, got: %s", h, v)
+		}
+	}
+	if got, want := got.Get(BaggageHeader), "tenant=acme"; got != want {
+		t.Errorf("want baggage: %s, got: %s", want, got)
+	}
+	if len(r.Header) != 0 {
+		t.Errorf("expected the original request not to be modified, got headers: %v", r.Header)
+	}
+
+	tp, err := ParseTraceParent(got.Get(TraceParentHeader))
+	if err != nil {
+		t.Fatalf("unexpected error parsing traceparent: %v", err)
+	}
+	if tp.TraceID != tc.TraceID {
+		t.Errorf("want trace-id: %s, got: %s", tc.TraceID, tp.TraceID)
+	}
+	if tp.ParentID == tc.SpanID {
+		t.Error("expected the outbound call to have its own span id")
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("want 1 event, got: %d", len(events))
+	}
+	ev := events[0]
+	if ev.StatusCode != http.StatusTeapot {
+		t.Errorf("want status: %d, got: %d", http.StatusTeapot, ev.StatusCode)
+	}
+	if ev.TrackingID != "some-id" {
+		t.Errorf("want tracking id: some-id, got: %s", ev.TrackingID)
+	}
+	if ev.ParentID != tc.SpanID.String() {
+		t.Errorf("want parent id: %s, got: %s", tc.SpanID, ev.ParentID)
+	}
+	if ev.SpanID != tp.ParentID.String() {
+		t.Errorf("want span id: %s, got: %s", tp.ParentID, ev.SpanID)
+	}
+}
+
+func TestTransportWithoutTrackingID(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	resp, err := NewClient(nil, Transport{}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if v := got.Get(Header); v != "" {
+		t.Errorf("expected no %s header, got: %s", Header, v)
+	}
+	if v := got.Get(TraceParentHeader); v != "" {
+		t.Errorf("expected no %s header, got: %s", TraceParentHeader, v)
+	}
+}
@@ -0,0 +1,303 @@
+package middlewares
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is an invalid field. Path is a JSON pointer, RFC 6901, to the field on the JSON
+// body, e.g. "/items/0/name".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors are all the invalid fields of a value.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Path + ": " + e.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate validates v, usually a pointer to a struct, according to the `validate` tag of its
+// fields, recursing into structs, pointers, slices, arrays and maps. The tag is a comma
+// separated list of rules:
+//
+//	required     the field must not be the zero value or empty, nor a nil pointer. Use a pointer
+//	             to accept 0, false or "", a non-nil pointer is never empty
+//	min=N, max=N the minimum and maximum length of strings, in characters, slices and maps or
+//	             value of numbers
+//	enum=a|b|c   the field must be one of the values
+//	regexp=RE    strings must match RE, it must be the last rule as RE may contain commas
+//
+// e.g. `validate:"required,max=64,regexp=^[a-z0-9-]+$"`. Rules other than required are not
+// checked on nil pointers and empty strings, slices and maps, so optional fields can be left
+// out. They are checked on numbers, 0 is a value, use a pointer to leave out an optional number.
+//
+// It returns ValidationErrors with all the invalid fields, or another error if a tag is invalid.
+func Validate(v interface{}) error {
+	var errs ValidationErrors
+	if err := validateValue(reflect.ValueOf(v), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return validateStruct(v, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), path+"/"+strconv.Itoa(i), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if err := validateValue(v.MapIndex(k), path+"/"+escapePointer(k.String()), errs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateStruct(v reflect.Value, path string, errs *ValidationErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		var fieldPath string
+		switch {
+		case f.Anonymous && name == "" && isStruct(f.Type):
+			// Embedded structs without a JSON name have their fields promoted, as encoding/json does.
+			fieldPath = path
+		case f.PkgPath != "":
+			continue
+		case name == "":
+			fieldPath = path + "/" + escapePointer(f.Name)
+		default:
+			fieldPath = path + "/" + escapePointer(name)
+		}
+
+		if rules := f.Tag.Get("validate"); rules != "" {
+			msg, err := checkRules(v.Field(i), rules)
+			if err != nil {
+				return fmt.Errorf("invalid validate tag on %s.%s: %w", t.Name(), f.Name, err)
+			}
+			if msg != "" {
+				*errs = append(*errs, FieldError{Path: fieldPath, Message: msg})
+				continue
+			}
+		}
+
+		if err := validateValue(v.Field(i), fieldPath, errs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// escapePointer escapes s to be a JSON pointer reference token.
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+// checkRules returns why v does not follow rules, or "" if it does.
+func checkRules(v reflect.Value, rules string) (string, error) {
+	isPtr, isNil := v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface, false
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			isNil = true
+			break
+		}
+		v = v.Elem()
+	}
+
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regexp=") {
+			rule, rules = rules, ""
+		} else if i := strings.IndexByte(rules, ','); i >= 0 {
+			rule, rules = rules[:i], rules[i+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		if name == "required" {
+			if isNil || (!isPtr && isEmpty(v)) {
+				return "is required", nil
+			}
+			continue
+		}
+		if isNil || (!isPtr && isEmpty(v) && !isNumber(v)) {
+			continue
+		}
+
+		var msg string
+		var err error
+		switch name {
+		case "min":
+			msg, err = checkBound(v, arg, true)
+		case "max":
+			msg, err = checkBound(v, arg, false)
+		case "enum":
+			msg, err = checkEnum(v, arg)
+		case "regexp":
+			msg, err = checkRegexp(v, arg)
+		default:
+			err = fmt.Errorf("unknown rule %q", rule)
+		}
+		if msg != "" || err != nil {
+			return msg, err
+		}
+	}
+
+	return "", nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func checkBound(v reflect.Value, arg string, isMin bool) (string, error) {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid bound %q: %w", arg, err)
+	}
+
+	var got float64
+	verb, unit := "must be", ""
+	switch v.Kind() {
+	case reflect.String:
+		got, unit = float64(utf8.RuneCountInString(v.String())), " characters long"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		got, verb, unit = float64(v.Len()), "must have", " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		got = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		got = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		got = v.Float()
+	default:
+		return "", fmt.Errorf("min and max do not apply to %s", v.Type())
+	}
+
+	switch {
+	case isMin && got < bound:
+		return verb + " at least " + arg + unit, nil
+	case !isMin && got > bound:
+		return verb + " at most " + arg + unit, nil
+	}
+	return "", nil
+}
+
+func checkEnum(v reflect.Value, arg string) (string, error) {
+	var got string
+	switch v.Kind() {
+	case reflect.String:
+		got = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		got = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		got = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		got = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Bool:
+		got = strconv.FormatBool(v.Bool())
+	default:
+		return "", fmt.Errorf("enum does not apply to %s", v.Type())
+	}
+
+	values := strings.Split(arg, "|")
+	for _, value := range values {
+		if got == value {
+			return "", nil
+		}
+	}
+	return "must be one of " + strings.Join(values, ", "), nil
+}
+
+// regexps caches the compiled regexp rules.
+var regexps sync.Map
+
+func checkRegexp(v reflect.Value, expr string) (string, error) {
+	if v.Kind() != reflect.String {
+		return "", fmt.Errorf("regexp does not apply to %s", v.Type())
+	}
+
+	re, ok := regexps.Load(expr)
+	if !ok {
+		compiled, err := regexp.Compile(expr)
+		if err != nil {
+			return "", err
+		}
+		re, _ = regexps.LoadOrStore(expr, compiled)
+	}
+
+	if !re.(*regexp.Regexp).MatchString(v.String()) {
+		return "must match " + expr, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,164 @@
+package middlewares
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testAddress struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"enum=DE|NL|BR"`
+}
+
+type testAudit struct {
+	CreatedBy string `json:"created_by" validate:"required"`
+}
+
+type testUser struct {
+	testAudit
+	Name    string                 `json:"name" validate:"required,min=2,max=10"`
+	Email   string                 `json:"email,omitempty" validate:"regexp=^[^@,]+@[^@,]+$"`
+	Age     *int                   `json:"age" validate:"required,min=18,max=130"`
+	Admin   *bool                  `json:"admin" validate:"required"`
+	Role    string                 `json:"role" validate:"enum=admin|user"`
+	Level   int                    `json:"level" validate:"enum=1|2|3"`
+	Items   int                    `json:"items" validate:"min=1,max=5"`
+	Tags    []string               `json:"tags" validate:"max=2"`
+	Address *testAddress           `json:"address" validate:"required"`
+	Others  []testAddress          `json:"other/addresses"`
+	ByName  map[string]testAddress `json:"by_name"`
+	Ignored string                 `json:"-" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	age := func(v int) *int { return &v }
+	valid := func() testUser {
+		return testUser{
+			testAudit: testAudit{CreatedBy: "admin"},
+			Name:      "gopher",
+			Email:     "gopher@golang.org",
+			Age:       age(18),
+			Admin:     new(bool),
+			Role:      "user",
+			Level:     2,
+			Items:     1,
+			Address:   &testAddress{City: "Berlin", Country: "DE"},
+		}
+	}
+
+	tcs := []struct {
+		name   string
+		modify func(u *testUser)
+		want   ValidationErrors
+	}{
+		{name: "valid", modify: func(u *testUser) {}},
+		{name: "optional fields empty", modify: func(u *testUser) { u.Email, u.Role, u.Address.Country = "", "user", "NL" }},
+		{
+			name:   "required",
+			modify: func(u *testUser) { u.Name, u.Age, u.Admin, u.Address, u.CreatedBy = "", nil, nil, nil, "" },
+			want: ValidationErrors{
+				{Path: "/created_by", Message: "is required"},
+				{Path: "/name", Message: "is required"},
+				{Path: "/age", Message: "is required"},
+				{Path: "/admin", Message: "is required"},
+				{Path: "/address", Message: "is required"},
+			},
+		},
+		{
+			name:   "required pointers to zero values",
+			modify: func(u *testUser) { u.Age = age(0) },
+			want:   ValidationErrors{{Path: "/age", Message: "must be at least 18"}},
+		},
+		{
+			name:   "min on a zero number",
+			modify: func(u *testUser) { u.Items = 0 },
+			want:   ValidationErrors{{Path: "/items", Message: "must be at least 1"}},
+		},
+		{
+			name:   "min and max",
+			modify: func(u *testUser) { u.Name, u.Age, u.Tags = "ñ", age(131), []string{"a", "b", "c"} },
+			want: ValidationErrors{
+				{Path: "/name", Message: "must be at least 2 characters long"},
+				{Path: "/age", Message: "must be at most 130"},
+				{Path: "/tags", Message: "must have at most 2 items"},
+			},
+		},
+		{
+			name:   "regexp and enum",
+			modify: func(u *testUser) { u.Email, u.Role, u.Level = "gopher", "root", 4 },
+			want: ValidationErrors{
+				{Path: "/email", Message: "must match ^[^@,]+@[^@,]+$"},
+				{Path: "/role", Message: "must be one of admin, user"},
+				{Path: "/level", Message: "must be one of 1, 2, 3"},
+			},
+		},
+		{
+			name: "nested",
+			modify: func(u *testUser) {
+				u.Address.City = ""
+				u.Others = []testAddress{{City: "Amsterdam"}, {City: "Recife", Country: "PT"}}
+				u.ByName = map[string]testAddress{"b": {}, "a/~": {City: "Porto", Country: "PT"}}
+			},
+			want: ValidationErrors{
+				{Path: "/address/city", Message: "is required"},
+				{Path: "/other~1addresses/1/country", Message: "must be one of DE, NL, BR"},
+				{Path: "/by_name/a~1~0/country", Message: "must be one of DE, NL, BR"},
+				{Path: "/by_name/b/city", Message: "is required"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			u := valid()
+			tc.modify(&u)
+
+			err := Validate(&u)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var got ValidationErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("want ValidationErrors, got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidTag(t *testing.T) {
+	tcs := []struct {
+		name string
+		v    interface{}
+	}{
+		{name: "unknown rule", v: &struct {
+			A string `validate:"nonsense"`
+		}{A: "a"}},
+		{name: "invalid bound", v: &struct {
+			A string `validate:"min=two"`
+		}{A: "a"}},
+		{name: "invalid regexp", v: &struct {
+			A string `validate:"regexp=("`
+		}{A: "a"}},
+		{name: "regexp on a number", v: &struct {
+			A int `validate:"regexp=^1$"`
+		}{A: 1}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.v)
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid validate tag") {
+				t.Errorf("want an invalid validate tag error, got: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/tracking"
+)
+
+// start_p OMIT
+func produce(ctx context.Context, ch chan<- tracking.Envelope) {
+	for i := 0; i < 10; i++ {
+		ch <- tracking.NewEnvelope(ctx, i) // the tracking id travels with the value // HL
+		time.Sleep(420 * time.Millisecond)
+	}
+	close(ch)
+}
+
+// end_p OMIT
+
+// start_c OMIT
+func consumer(id int, ch <-chan tracking.Envelope) {
+	for e := range ch {
+		ctx := e.Context(context.Background()) // HL
+		fmt.Printf("[%d][%s] received: %d, queued for %s\n",
+			id, tracking.IdFromContext(ctx), e.Payload.(int), e.Age())
+	}
+}
+
+// end_c OMIT
+
+// start_main OMIT
+func main() {
+	// in a http handler it'd be the request context
+	ctx, err := tracking.ContextWithID(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	ch := make(chan tracking.Envelope)
+
+	for i := 0; i < 5; i++ {
+		go consumer(i, ch)
+	}
+
+	produce(ctx, ch)
+
+	fmt.Println("done :)")
+}
+
+// end_main OMIT
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/ratelimit"
+)
+
+type User struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// start_fetch OMIT
+
+// at most 2 requests per second, no bursts
+var limiter = ratelimit.New(ratelimit.Config{Rate: 2, Burst: 1})
+
+func fetch(ctx context.Context, userID string, ch chan<- User) {
+	if err := limiter.Wait(ctx, "jsonplaceholder"); err != nil { // HL
+		log.Printf("[ERROR] gave up fetching userID %s: %v", userID, err)
+		ch <- User{}
+		return
+	}
+	start := time.Now()
+
+	user := User{}
+	resp, err := http.Get("https://jsonplaceholder.typicode.com/users/" + userID)
+	if err != nil {
+		log.Printf("[ERROR] could not fetch userID %s: %v", userID, err)
+		ch <- user
+		return
+	}
+	defer resp.Body.Close()
+
+	_ = json.NewDecoder(resp.Body).Decode(&user)
+
+	fmt.Printf("elapsed %dms to fetch user %s\n", time.Since(start)/time.Millisecond, userID)
+	ch <- user
+}
+
+// end_fetch OMIT
+
+// start_main OMIT
+func main() {
+	userIDs := []string{"1", "2", "3", "4", "5", "42"}
+	ch := make(chan User, len(userIDs))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	for _, id := range userIDs {
+		go fetch(ctx, id, ch) // all start at once, the limiter spreads the requests // HL
+	}
+
+	var users []User
+	for i := 0; i < len(userIDs); i++ {
+		users = append(users, <-ch)
+	}
+
+	fmt.Printf("total elapsed time: %dms to fetch %d users\n",
+		time.Since(start)/time.Millisecond, len(users))
+}
+
+// end_main OMIT
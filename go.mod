@@ -9,5 +9,6 @@ require (
 	github.com/stretchr/testify v1.5.1 // indirect
 	github.com/yuin/goldmark v1.1.32 // indirect
 	golang.org/dl v0.0.0-20200514221906-2a7874809c5f // indirect
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	golang.org/x/tools v0.0.0-20200624060801-dcbf2a9ed15d // indirect
 )
@@ -19,11 +19,41 @@ type Config struct {
 
 	// RequestTimeout the timeout for the incoming request
 	RequestTimeout time.Duration `env:"REQUEST_TIMEOUT" envDefault:"5s"`
+	// MaxBodyBytes the maximum size of the incoming request bodies
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES" envDefault:"1048576"`
+
+	// CORS configuration, lists are comma separated but the regexps, which are space separated.
+	// Unset values take the middlewares.CORSConfig defaults
+	CORSAllowedOrigins       []string      `env:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowedOriginRegexps []string      `env:"CORS_ALLOWED_ORIGIN_REGEXPS" envSeparator:" "`
+	CORSAllowedMethods       []string      `env:"CORS_ALLOWED_METHODS"`
+	CORSAllowedHeaders       []string      `env:"CORS_ALLOWED_HEADERS"`
+	CORSExposedHeaders       []string      `env:"CORS_EXPOSED_HEADERS"`
+	CORSAllowCredentials     bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	CORSMaxAge               time.Duration `env:"CORS_MAX_AGE"`
+
+	// Authentication, keys are comma separated id:secret pairs
+	AuthAPIKeys          []string      `env:"AUTH_API_KEYS"`
+	AuthHMACKeys         []string      `env:"AUTH_HMAC_KEYS"`
+	AuthHMACWindow       time.Duration `env:"AUTH_HMAC_WINDOW" envDefault:"5m"`
+	AuthJWTSecret        string        `env:"AUTH_JWT_SECRET"`
+	AuthJWTPublicKeyFile string        `env:"AUTH_JWT_PUBLIC_KEY_FILE"`
+	AuthJWKSFile         string        `env:"AUTH_JWKS_FILE"`
+	AuthJWTIssuer        string        `env:"AUTH_JWT_ISSUER"`
+	AuthJWTAudience      string        `env:"AUTH_JWT_AUDIENCE"`
+	AuthHtpasswdFile     string        `env:"AUTH_HTPASSWD_FILE"`
+	AuthHtpasswdReload   time.Duration `env:"AUTH_HTPASSWD_RELOAD" envDefault:"5s"`
+	AuthMaxFailures      int           `env:"AUTH_MAX_FAILURES" envDefault:"5"`
+
+	// Response cache, the vary headers are comma separated
+	CacheMaxBytes   int64         `env:"CACHE_MAX_BYTES" envDefault:"67108864"`
+	CacheVary       []string      `env:"CACHE_VARY" envDefault:"Accept,Accept-Encoding"`
+	CacheDefaultTTL time.Duration `env:"CACHE_DEFAULT_TTL" envDefault:"0s"`
 }
 
 func Parse() (Config, error) {
 	cfg := Config{}
-	err := env.Parse(&Config{})
+	err := env.Parse(&cfg)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to parse environment variables: %w", err)
 	}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/rsa"
+	"errors"
+
+	middlewares "github.com/AndersonQ/gogettingstarted/02-http-middlewares"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+	"github.com/rs/zerolog"
+)
+
+// TimeoutConfig returns the middlewares.TimeoutConfig with RequestTimeout as the timeout for all routes.
+func (c Config) TimeoutConfig() middlewares.TimeoutConfig {
+	return middlewares.TimeoutConfig{Timeout: c.RequestTimeout}
+}
+
+// CORSConfig returns the middlewares.CORSConfig set by the CORS_* environment variables.
+func (c Config) CORSConfig() middlewares.CORSConfig {
+	return middlewares.CORSConfig{
+		AllowedOrigins:       c.CORSAllowedOrigins,
+		AllowedOriginRegexps: c.CORSAllowedOriginRegexps,
+		AllowedMethods:       c.CORSAllowedMethods,
+		AllowedHeaders:       c.CORSAllowedHeaders,
+		ExposedHeaders:       c.CORSExposedHeaders,
+		AllowCredentials:     c.CORSAllowCredentials,
+		MaxAge:               c.CORSMaxAge,
+	}
+}
+
+// APIKeys returns auth.APIKeys accepting the AUTH_API_KEYS keys on auth.APIKeyHeader.
+// It returns an error if there are none or they are invalid.
+func (c Config) APIKeys() (*auth.APIKeys, error) {
+	keys, err := auth.ParseAPIKeys(c.AuthAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no API keys configured")
+	}
+	return auth.NewAPIKeys("", keys), nil
+}
+
+// HMACConfig returns the auth.HMACConfig with the AUTH_HMAC_KEYS keys, AUTH_HMAC_WINDOW and
+// MAX_BODY_BYTES. It returns an error if there are no keys or they are invalid.
+func (c Config) HMACConfig() (auth.HMACConfig, error) {
+	keys, err := auth.ParseHMACKeys(c.AuthHMACKeys)
+	if err != nil {
+		return auth.HMACConfig{}, err
+	}
+	if len(keys) == 0 {
+		return auth.HMACConfig{}, errors.New("no HMAC keys configured")
+	}
+	return auth.HMACConfig{Keys: keys, Window: c.AuthHMACWindow, MaxBodyBytes: c.MaxBodyBytes}, nil
+}
+
+// JWTConfig returns the auth.JWTConfig with the AUTH_JWT_SECRET, the RSA public key on
+// AUTH_JWT_PUBLIC_KEY_FILE and the ones on the AUTH_JWKS_FILE key set, requiring the
+// AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE claims if set. The secret and the public key have no
+// key id, so they only verify tokens without one, if they are the only key of their type.
+// It returns an error if the files cannot be loaded.
+func (c Config) JWTConfig() (auth.JWTConfig, error) {
+	cfg := auth.JWTConfig{Issuer: c.AuthJWTIssuer, Audience: c.AuthJWTAudience}
+
+	if c.AuthJWTSecret != "" {
+		cfg.HMACKeys = map[string][]byte{"": []byte(c.AuthJWTSecret)}
+	}
+	if c.AuthJWKSFile != "" {
+		keys, err := auth.LoadJWKSFile(c.AuthJWKSFile)
+		if err != nil {
+			return auth.JWTConfig{}, err
+		}
+		cfg.RSAKeys = keys
+	}
+	if c.AuthJWTPublicKeyFile != "" {
+		key, err := auth.LoadRSAPublicKeyFile(c.AuthJWTPublicKeyFile)
+		if err != nil {
+			return auth.JWTConfig{}, err
+		}
+		if cfg.RSAKeys == nil {
+			cfg.RSAKeys = map[string]*rsa.PublicKey{}
+		}
+		cfg.RSAKeys[""] = key
+	}
+
+	return cfg, nil
+}
+
+// HtpasswdConfig returns the auth.HtpasswdConfig with the AUTH_HTPASSWD_FILE,
+// AUTH_HTPASSWD_RELOAD and AUTH_MAX_FAILURES, logging to logger.
+func (c Config) HtpasswdConfig(logger zerolog.Logger) auth.HtpasswdConfig {
+	return auth.HtpasswdConfig{
+		Path:           c.AuthHtpasswdFile,
+		ReloadInterval: c.AuthHtpasswdReload,
+		MaxFailures:    c.AuthMaxFailures,
+		Logger:         logger,
+	}
+}
+
+// BodyLimitConfig returns the middlewares.BodyLimitConfig with MAX_BODY_BYTES as the limit,
+// accepting JSON bodies.
+func (c Config) BodyLimitConfig() middlewares.BodyLimitConfig {
+	return middlewares.BodyLimitConfig{MaxBytes: c.MaxBodyBytes}
+}
+
+// ResponseCacheConfig returns the middlewares.ResponseCacheConfig set by the CACHE_*
+// environment variables, logging to logger.
+func (c Config) ResponseCacheConfig(logger zerolog.Logger) middlewares.ResponseCacheConfig {
+	return middlewares.ResponseCacheConfig{
+		MaxBytes:   c.CacheMaxBytes,
+		Vary:       c.CacheVary,
+		DefaultTTL: c.CacheDefaultTTL,
+		Logger:     logger,
+	}
+}
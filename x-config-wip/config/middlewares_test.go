@@ -0,0 +1,202 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	middlewares "github.com/AndersonQ/gogettingstarted/02-http-middlewares"
+	"github.com/AndersonQ/gogettingstarted/02-http-middlewares/auth"
+	"github.com/rs/zerolog"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestTimeoutConfig(t *testing.T) {
+	got := Config{RequestTimeout: 10 * time.Millisecond}.TimeoutConfig()
+
+	if got.Timeout != 10*time.Millisecond {
+		t.Errorf("want: %v, got: %v", 10*time.Millisecond, got.Timeout)
+	}
+}
+
+func TestCORSConfig(t *testing.T) {
+	cfg := Config{
+		CORSAllowedOrigins:       []string{"https://example.com"},
+		CORSAllowedOriginRegexps: []string{`https://[a-z]+\.example\.org`},
+		CORSAllowedMethods:       []string{http.MethodPut},
+		CORSAllowedHeaders:       []string{"X-Custom"},
+		CORSExposedHeaders:       []string{"X-Total"},
+		CORSAllowCredentials:     true,
+		CORSMaxAge:               time.Minute,
+	}
+	want := middlewares.CORSConfig{
+		AllowedOrigins:       []string{"https://example.com"},
+		AllowedOriginRegexps: []string{`https://[a-z]+\.example\.org`},
+		AllowedMethods:       []string{http.MethodPut},
+		AllowedHeaders:       []string{"X-Custom"},
+		ExposedHeaders:       []string{"X-Total"},
+		AllowCredentials:     true,
+		MaxAge:               time.Minute,
+	}
+
+	if got := cfg.CORSConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	a, err := Config{AuthAPIKeys: []string{"ci:key-1"}}.APIKeys()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(auth.APIKeyHeader, "key-1")
+	if p, err := a.Authenticate(r); err != nil || p.ID != "ci" {
+		t.Errorf("want principal ci, got: %q, %v", p.ID, err)
+	}
+
+	for _, keys := range [][]string{nil, {"no-separator"}} {
+		if _, err := (Config{AuthAPIKeys: keys}).APIKeys(); err == nil {
+			t.Errorf("%q: expected an error, got nil", keys)
+		}
+	}
+}
+
+func TestHMACConfig(t *testing.T) {
+	got, err := Config{
+		AuthHMACKeys:   []string{"ci:s3cr3t"},
+		AuthHMACWindow: time.Minute,
+		MaxBodyBytes:   4,
+	}.HMACConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := auth.HMACConfig{Keys: map[string][]byte{"ci": []byte("s3cr3t")}, Window: time.Minute, MaxBodyBytes: 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+
+	if _, err := (Config{}).HMACConfig(); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
+
+func TestJWTConfig(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	dir := tempDir(t)
+
+	keyPath := filepath.Join(dir, "key.pem")
+	block := &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "rsa-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("could not encode JWKS: %v", err)
+	}
+	jwksPath := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(jwksPath, jwks, 0600); err != nil {
+		t.Fatalf("could not write JWKS: %v", err)
+	}
+
+	got, err := Config{
+		AuthJWTSecret:        "hs256-secret",
+		AuthJWTPublicKeyFile: keyPath,
+		AuthJWKSFile:         jwksPath,
+		AuthJWTIssuer:        "https://issuer.example",
+		AuthJWTAudience:      "orders",
+	}.JWTConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := auth.JWTConfig{
+		HMACKeys: map[string][]byte{"": []byte("hs256-secret")},
+		RSAKeys:  map[string]*rsa.PublicKey{"": &key.PublicKey, "rsa-1": &key.PublicKey},
+		Issuer:   "https://issuer.example",
+		Audience: "orders",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+
+	for name, cfg := range map[string]Config{
+		"missing key file": {AuthJWTPublicKeyFile: filepath.Join(dir, "missing.pem")},
+		"missing JWKS":     {AuthJWKSFile: filepath.Join(dir, "missing.json")},
+	} {
+		if _, err := cfg.JWTConfig(); err == nil {
+			t.Errorf("%s: expected an error, got nil", name)
+		}
+	}
+}
+
+func TestHtpasswdConfig(t *testing.T) {
+	logger := zerolog.Nop()
+	got := Config{
+		AuthHtpasswdFile:   "/etc/app/.htpasswd",
+		AuthHtpasswdReload: time.Minute,
+		AuthMaxFailures:    3,
+	}.HtpasswdConfig(logger)
+
+	want := auth.HtpasswdConfig{Path: "/etc/app/.htpasswd", ReloadInterval: time.Minute, MaxFailures: 3, Logger: logger}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func TestBodyLimitConfig(t *testing.T) {
+	got := Config{MaxBodyBytes: 8}.BodyLimitConfig()
+
+	if got.MaxBytes != 8 {
+		t.Errorf("want: %d, got: %d", 8, got.MaxBytes)
+	}
+}
+
+func TestResponseCacheConfig(t *testing.T) {
+	logger := zerolog.Nop()
+	got := Config{
+		CacheMaxBytes:   1024,
+		CacheVary:       []string{"Accept"},
+		CacheDefaultTTL: time.Minute,
+	}.ResponseCacheConfig(logger)
+
+	want := middlewares.ResponseCacheConfig{MaxBytes: 1024, Vary: []string{"Accept"}, DefaultTTL: time.Minute, Logger: logger}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+}
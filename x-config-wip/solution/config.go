@@ -29,7 +29,7 @@ func ParseManual() (Config, error) {
 
 func Parse() (Config, error) {
 	cfg := Config{}
-	err := env.Parse(&Config{})
+	err := env.Parse(&cfg)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to parse environment variables: %w", err)
 	}